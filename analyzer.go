@@ -1,11 +1,18 @@
 package servicetracer
 
 import (
+	"context"
 	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
-	"unicode"
 
 	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/rta"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/pointer"
 	"golang.org/x/tools/go/ssa"
@@ -14,14 +21,64 @@ import (
 )
 
 type Analyzer struct {
-	cfg *Config
+	cfg            *Config
+	detectors      []Detector
+	entryDetectors []EntryDetector
+	progress       *progress
+	// output is the writer of the messages other than the progress events ( e.g. skipped packages ).
+	output io.Writer
 }
 
 func NewAnalyzer(cfg *Config) *Analyzer {
-	return &Analyzer{cfg: cfg}
+	a := &Analyzer{
+		cfg:      cfg,
+		progress: newProgress(NewTextProgressReporter(os.Stdout)),
+		output:   os.Stdout,
+	}
+	a.RegisterDetector(&GRPCDetector{})
+	a.RegisterDetector(&InvokeDetector{})
+	a.RegisterDetector(&HTTPDetector{})
+	a.RegisterDetector(&BrokerDetector{})
+	a.RegisterDetector(&TableDetector{})
+	a.RegisterEntryDetector(&GatewayDetector{})
+	a.RegisterEntryDetector(&HTTPHandlerDetector{})
+	a.RegisterEntryDetector(&CallerDetector{})
+	return a
+}
+
+// RegisterDetector adds detector to find outbound dependencies.
+// If detector also implements EntryDetector, it is used to find entry points as well.
+// Detectors are consulted in the order of registration after the built-in detectors.
+func (a *Analyzer) RegisterDetector(detector Detector) {
+	a.detectors = append(a.detectors, detector)
+	if entryDetector, ok := detector.(EntryDetector); ok {
+		a.RegisterEntryDetector(entryDetector)
+	}
+}
+
+// SetProgressReporter changes the reporter of the stages of the analysis.
+func (a *Analyzer) SetProgressReporter(reporter ProgressReporter) {
+	a.progress = newProgress(reporter)
+}
+
+// SetMessageOutput changes the writer of the messages other than the progress events.
+func (a *Analyzer) SetMessageOutput(w io.Writer) {
+	a.output = w
+}
+
+// RegisterEntryDetector adds detector to find entry points other than gRPC handlers.
+func (a *Analyzer) RegisterEntryDetector(detector EntryDetector) {
+	a.entryDetectors = append(a.entryDetectors, detector)
 }
 
 func (a *Analyzer) Analyze(service *Service) (MethodMap, error) {
+	return a.AnalyzeContext(context.Background(), service)
+}
+
+// AnalyzeContext analyzes all entries of the service.
+// Entries in the same module are loaded into one SSA program and analyzed at once.
+// ctx is checked between the stages, because loading packages is the only stage which can be cancelled on the way.
+func (a *Analyzer) AnalyzeContext(ctx context.Context, service *Service) (MethodMap, error) {
 	mtdMap, err := service.MethodNameMap()
 	if err != nil {
 		return nil, xerrors.Errorf("failed to get method map: %w", err)
@@ -31,122 +88,333 @@ func (a *Analyzer) Analyze(service *Service) (MethodMap, error) {
 		return nil, xerrors.Errorf("failed to get entries: %w", err)
 	}
 	analyzedMethodMap := MethodMap{}
-	fmt.Printf("analyzing %s...\n", service.Name)
-	for _, path := range paths {
-		mainPkgs, err := a.mainPackages(path)
+	groups, err := a.groupEntries(service, paths)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to group entries: %w", err)
+	}
+	for _, group := range groups {
+		mainPkgs, err := a.mainPackages(ctx, service, group)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get main packages: %w", err)
+		}
 		if len(mainPkgs) == 0 {
 			continue
 		}
-		cg, err := a.createCallGraph(mainPkgs)
-		if err != nil {
-			return nil, xerrors.Errorf("failed to create callgraph: %w", err)
+		if err := a.analyzeProgram(ctx, service, mainPkgs, mtdMap, analyzedMethodMap); err != nil {
+			return nil, err
 		}
+	}
+	return analyzedMethodMap, nil
+}
+
+// analyzeProgram builds the call graph of the main packages and adds the methods found in it to analyzedMethodMap.
+func (a *Analyzer) analyzeProgram(ctx context.Context, service *Service, mainPkgs []*ssa.Package, mtdMap map[string][]*Method, analyzedMethodMap MethodMap) error {
+	done := a.progress.start(service.Name, CallGraphStage)
+	cg, err := a.createCallGraph(service, mainPkgs)
+	done(err)
+	if err != nil {
+		return xerrors.Errorf("failed to create callgraph: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done = a.progress.start(service.Name, TraverseStage)
+	err = a.traverse(ctx, service, cg, mainPkgs, mtdMap, analyzedMethodMap)
+	done(err)
+	if err != nil {
+		return xerrors.Errorf("failed to traverse callgraph: %w", err)
+	}
+	return nil
+}
 
-		var (
-			edgeMap          = map[int][]*callgraph.Node{}
-			methodToNodesMap = map[*Method][]*callgraph.Node{}
-		)
-		if err := callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
-			caller := edge.Caller
-			callerID := caller.ID
+// traverse finds the handlers and the other entry points in the call graph and their dependencies.
+func (a *Analyzer) traverse(ctx context.Context, service *Service, cg *callgraph.Graph, mainPkgs []*ssa.Package, mtdMap map[string][]*Method, analyzedMethodMap MethodMap) error {
+	binaries := a.reachableBinaries(service, cg, mainPkgs)
 
-			edgeMap[callerID] = append(edgeMap[callerID], edge.Callee)
+	edgeMap := map[int][]*callgraph.Edge{}
+	callers := []*callgraph.Node{}
+	if err := callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
+		caller := edge.Caller
+		if _, exists := edgeMap[caller.ID]; !exists {
+			callers = append(callers, caller)
+		}
+		edgeMap[caller.ID] = append(edgeMap[caller.ID], edge)
+		return nil
+	}); err != nil {
+		return xerrors.Errorf("failed to walk edges: %w", err)
+	}
+	// GraphVisitEdges visits nodes in random order, so sort them to make the output deterministic.
+	sortNodes(callers)
+	for _, edges := range edgeMap {
+		sortEdges(edges)
+	}
 
-			mtds, exists := mtdMap[caller.Func.Name()]
-			if !exists {
-				return nil
+	var (
+		handlerMethods   = []*Method{}
+		methodToNodesMap = map[*Method][]*callgraph.Node{}
+	)
+	for _, caller := range callers {
+		mtds, exists := mtdMap[caller.Func.Name()]
+		if !exists {
+			continue
+		}
+		matched := a.handlerMethods(caller.Func, mtds)
+		if len(matched) == 0 {
+			continue
+		}
+		if len(matched) > 1 {
+			names := make([]string, 0, len(matched))
+			for _, mtd := range matched {
+				names = append(names, fmt.Sprintf("%s/%s", mtd.ProtoServiceFullName(), mtd.Name))
 			}
+			fmt.Fprintf(a.output, "warning: %s matches multiple methods ( %s ). use %s\n", caller.Func, strings.Join(names, ", "), names[0])
+		}
+		mtd := matched[0]
+		if _, exists := methodToNodesMap[mtd]; !exists {
+			handlerMethods = append(handlerMethods, mtd)
+		}
+		methodToNodesMap[mtd] = append(methodToNodesMap[mtd], caller)
+	}
+	sortMethods(handlerMethods)
 
-			sig := caller.Func.Signature
-			params := sig.Params()
-			results := sig.Results()
+	registrations, err := a.registrations(cg)
+	if err != nil {
+		return xerrors.Errorf("failed to find registrations: %w", err)
+	}
+	handlers := []*AnalyzedMethod{}
+	handlerServers := map[*AnalyzedMethod][]*ssa.Call{}
+	for _, mtd := range handlerMethods {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		nodes := methodToNodesMap[mtd]
+		analyzedMethod, err := a.analyzeRoot(&DetectContext{
+			Config:    a.cfg,
+			Service:   service,
+			CallGraph: cg,
+			Method:    mtd,
+		}, nodes, edgeMap, nil)
+		if err != nil {
+			return xerrors.Errorf("failed to analyze %s: %w", mtd.Name, err)
+		}
+		analyzedMethod.Binaries = binaries.of(nodes)
+		analyzedMethodMap[mtd.MangledName()] = analyzedMethod
+		handlers = append(handlers, analyzedMethod)
+		handlerServers[analyzedMethod] = a.handlerServers(registrations, mtd, nodes)
+	}
 
-			// gRPC methods has two request parameters.
-			// First:  context.Context
-			// Second: custom request structure.
-			if params.Len() < 2 {
-				return nil
-			}
+	entries, err := a.detectEntries(&DetectContext{
+		Config:    a.cfg,
+		Service:   service,
+		CallGraph: cg,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to detect entries: %w", err)
+	}
+	others := []*AnalyzedMethod{}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		analyzedMethod, err := a.analyzeRoot(&DetectContext{
+			Config:    a.cfg,
+			Service:   service,
+			CallGraph: cg,
+			Method:    entry.Method,
+		}, entry.Roots, edgeMap, nil)
+		if err != nil {
+			return xerrors.Errorf("failed to analyze %s: %w", entry.Method.Name, err)
+		}
+		analyzedMethod.Entry = entry.Method
+		analyzedMethod.Binaries = binaries.of(entry.Roots)
+		analyzedMethod.Subscriptions = entry.Subscriptions
+		analyzedMethodMap[entry.Method.MangledName()] = analyzedMethod
+		others = append(others, analyzedMethod)
+	}
 
-			// gRPC methods has two response parameters.
-			// First: custom response structure.
-			// Second: error
-			if results.Len() < 2 {
-				return nil
-			}
+	interceptors, err := a.detectInterceptors(cg)
+	if err != nil {
+		return xerrors.Errorf("failed to detect interceptors: %w", err)
+	}
+	for _, i := range interceptors {
+		i.binaries = binaries.of(i.roots)
+	}
+	if err := a.attributeInterceptors(&DetectContext{
+		Config:    a.cfg,
+		Service:   service,
+		CallGraph: cg,
+	}, interceptors, edgeMap, handlers, others, handlerServers); err != nil {
+		return xerrors.Errorf("failed to attribute interceptors: %w", err)
+	}
+	return nil
+}
 
-			// First argument of gRPC method expects context.Context.
-			if params.At(0).Type().String() != "context.Context" {
-				return nil
+// handlerMethods returns the methods parsed from proto which fn serves.
+// If fn matches several methods ( e.g. services in the same package declare the same method ),
+// the methods of the services whose server interface is implemented by the receiver are preferred.
+// The result is sorted, so the first one is chosen deterministically even if it's still ambiguous.
+// The client stubs generated for the methods have the same signature, so they don't serve the methods.
+func (a *Analyzer) handlerMethods(fn *ssa.Function, mtds []*Method) []*Method {
+	reqType, respType, ok := rpcMessageTypes(fn.Signature)
+	if !ok {
+		return nil
+	}
+	matched := []*Method{}
+	for _, mtd := range mtds {
+		if fn.Pkg != nil && fn.Pkg.Pkg.Path() == mtd.GeneratedPath {
+			continue
+		}
+		inType := fmt.Sprintf("*%s.%s", mtd.GeneratedPath, mtd.InputType)
+		if reqType != inType {
+			continue
+		}
+		outType := fmt.Sprintf("*%s.%s", mtd.GeneratedPath, mtd.OutputType)
+		if respType != outType {
+			continue
+		}
+		matched = append(matched, mtd)
+	}
+	if len(matched) > 1 {
+		implemented := []*Method{}
+		for _, mtd := range matched {
+			if a.implementsServer(fn, mtd) {
+				implemented = append(implemented, mtd)
 			}
+		}
+		if len(implemented) != 0 {
+			matched = implemented
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].ProtoServiceFullName() < matched[j].ProtoServiceFullName()
+	})
+	return matched
+}
 
-			var filteredMethods []*Method
-			for _, mtd := range mtds {
-				inType := fmt.Sprintf("*%s.%s", mtd.GeneratedPath, mtd.InputType)
-				if params.At(1).Type().String() != inType {
-					continue
-				}
-				outType := fmt.Sprintf("*%s.%s", mtd.GeneratedPath, mtd.OutputType)
-				if results.At(0).Type().String() != outType {
-					continue
-				}
-				filteredMethods = append(filteredMethods, mtd)
-			}
-			if len(filteredMethods) == 0 {
-				return nil
-			}
-			mtd := filteredMethods[0]
-			methodToNodesMap[mtd] = append(methodToNodesMap[mtd], caller)
-			return nil
-		}); err != nil {
-			return nil, xerrors.Errorf("failed to walk edges: %w", err)
-		}
-
-		for mtd, nodes := range methodToNodesMap {
-			funcs := []*ssa.Function{}
-			nodeMap := map[int]struct{}{}
-			protoGoRepo := mtd.GeneratedPathToRepo()
-			for _, node := range nodes {
-				for _, f := range a.getGRPCMethods(service, protoGoRepo, node, edgeMap, nodeMap) {
-					funcs = append(funcs, f)
-				}
-			}
+// implementsServer reports whether the receiver of fn implements the server interface generated for the service of mtd.
+func (a *Analyzer) implementsServer(fn *ssa.Function, mtd *Method) bool {
+	recv := fn.Signature.Recv()
+	if recv == nil || mtd.ProtoService == "" {
+		return false
+	}
+	pkg := fn.Prog.ImportedPackage(mtd.GeneratedPath)
+	if pkg == nil {
+		return false
+	}
+	// Twirp generates the interface named by the service for both the server and the client.
+	obj := pkg.Pkg.Scope().Lookup(fmt.Sprintf("%sServer", mtd.ProtoService))
+	if obj == nil {
+		obj = pkg.Pkg.Scope().Lookup(mtd.ProtoService)
+	}
+	if obj == nil {
+		return false
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return false
+	}
+	return types.Implements(recv.Type(), iface)
+}
 
-			methodName := mtd.MangledName()
-			calledMethodNameMap := map[string]struct{}{}
-			var sourceURL string
-			for _, node := range nodes {
-				url, err := a.ssaFuncToSourceURL(service, node.Func)
-				if err != nil {
-					continue
-				}
-				sourceURL = url
-				break
+// analyzeRoot finds outbound dependencies by traversing the call graph from nodes.
+// The traversal doesn't follow the edges that skip reports true.
+func (a *Analyzer) analyzeRoot(ctx *DetectContext, nodes []*callgraph.Node, edgeMap map[int][]*callgraph.Edge, skip func(*callgraph.Edge) bool) (*AnalyzedMethod, error) {
+	callMap, err := a.getDependencies(ctx, nodes, edgeMap, skip)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get dependencies: %w", err)
+	}
+	var sourceURL string
+	for _, node := range nodes {
+		url, err := a.ssaFuncToSourceURL(ctx.Service, node.Func)
+		if err != nil {
+			continue
+		}
+		sourceURL = url
+		break
+	}
+	analyzedMethod := &AnalyzedMethod{
+		SourceURL:    sourceURL,
+		Methods:      []*Method{},
+		Dependencies: []*Dependency{},
+	}
+	names := make([]string, 0, len(callMap))
+	for name := range callMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		call := callMap[name]
+		dep := &Dependency{
+			Method:    call.target,
+			Path:      a.edgesToCallSites(ctx.Service, call.path),
+			CallSites: a.mergeCallSites(nil, a.edgesToCallSites(ctx.Service, call.sites)),
+		}
+		sortCallSites(dep.CallSites)
+		dep.classify()
+		analyzedMethod.Methods = append(analyzedMethod.Methods, call.target)
+		analyzedMethod.Dependencies = append(analyzedMethod.Dependencies, dep)
+	}
+	return analyzedMethod, nil
+}
+
+// detectEntries consults the entry detectors for each edge of the call graph.
+// Entries having the same method are merged.
+func (a *Analyzer) detectEntries(ctx *DetectContext) ([]*Entry, error) {
+	entryMap := map[string]*Entry{}
+	entries := []*Entry{}
+	if err := callgraph.GraphVisitEdges(ctx.CallGraph, func(edge *callgraph.Edge) error {
+		for _, detector := range a.entryDetectors {
+			detected, err := detector.DetectEntry(ctx, edge)
+			if err != nil {
+				return xerrors.Errorf("failed to detect entry by %s: %w", detector.Name(), err)
 			}
-			analyzedMethodMap[methodName] = &AnalyzedMethod{
-				SourceURL: sourceURL,
-				Methods:   []*Method{},
+			if len(detected) == 0 {
+				continue
 			}
-			for _, f := range funcs {
-				calledMethod, err := a.ssaFuncToMethod(f)
-				if err != nil {
-					return nil, xerrors.Errorf("failed to convert ssa.Function to Method: %w", err)
-				}
-
-				// ignore duplicated methods
-				calledMethodName := calledMethod.MangledName()
-				if _, exists := calledMethodNameMap[calledMethodName]; exists {
+			for _, entry := range detected {
+				name := entry.Method.MangledName()
+				e, exists := entryMap[name]
+				if !exists {
+					entryMap[name] = entry
+					entries = append(entries, entry)
 					continue
 				}
-				calledMethodNameMap[calledMethodName] = struct{}{}
-				analyzedMethodMap[methodName].Methods = append(analyzedMethodMap[methodName].Methods, calledMethod)
+				e.Roots = append(e.Roots, entry.Roots...)
+				for _, topic := range entry.Subscriptions {
+					if !containsMethod(e.Subscriptions, topic) {
+						e.Subscriptions = append(e.Subscriptions, topic)
+					}
+				}
 			}
+			break
 		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to walk edges: %w", err)
 	}
-	return analyzedMethodMap, nil
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Method.MangledName() < entries[j].Method.MangledName()
+	})
+	for _, entry := range entries {
+		sortNodes(entry.Roots)
+		sortMethods(entry.Subscriptions)
+	}
+	return entries, nil
 }
 
-func (a *Analyzer) createCallGraph(mainPkgs []*ssa.Package) (*callgraph.Graph, error) {
+// createCallGraph builds the call graph by pointer analysis from main.
+// If the service has the functions main doesn't reach without reflection ( e.g. constructors provided to fx ),
+// rapid type analysis is used instead because pointer analysis can't start from other than main.
+func (a *Analyzer) createCallGraph(service *Service, mainPkgs []*ssa.Package) (*callgraph.Graph, error) {
+	prog := mainPkgs[0].Prog
+	if roots := a.analysisRoots(service, prog); len(roots) != 0 {
+		cg, err := a.createRTACallGraph(prog, mainPkgs, roots)
+		if err != nil {
+			return nil, err
+		}
+		a.excludeNodes(service, cg)
+		return cg, nil
+	}
 	config := &pointer.Config{
 		Mains:          mainPkgs,
 		BuildCallGraph: true,
@@ -157,34 +425,143 @@ func (a *Analyzer) createCallGraph(mainPkgs []*ssa.Package) (*callgraph.Graph, e
 	}
 	cg := result.CallGraph
 	cg.DeleteSyntheticNodes()
+	a.excludeNodes(service, cg)
+	return cg, nil
+}
+
+// excludeNodes removes the nodes of the functions in the packages excluded by the service from the call graph,
+// so the edges to the implementations created by them aren't considered.
+// The functions are left as is because the program is shared by the services in the same module.
+func (a *Analyzer) excludeNodes(service *Service, cg *callgraph.Graph) {
+	if len(service.Packages.Exclude) == 0 {
+		return
+	}
+	for fn, node := range cg.Nodes {
+		if node == cg.Root || fn == nil || fn.Pkg == nil || !service.Packages.Excludes(fn.Pkg.Pkg.Path()) {
+			continue
+		}
+		cg.DeleteNode(node)
+	}
+}
+
+// createRTACallGraph builds the call graph by rapid type analysis from main and roots.
+// The synthetic root node calls main and roots like the call graph built by pointer analysis.
+func (a *Analyzer) createRTACallGraph(prog *ssa.Program, mainPkgs []*ssa.Package, roots []*ssa.Function) (*callgraph.Graph, error) {
+	funcs := []*ssa.Function{}
+	for _, pkg := range mainPkgs {
+		if init := pkg.Func("init"); init != nil {
+			funcs = append(funcs, init)
+		}
+		funcs = append(funcs, pkg.Func("main"))
+	}
+	funcs = append(funcs, roots...)
+	result := rta.Analyze(funcs, true)
+
+	cg := callgraph.New(prog.NewFunction("<root>", new(types.Signature), "root of callgraph"))
+	for _, fn := range funcs {
+		callgraph.AddEdge(cg.Root, nil, cg.CreateNode(fn))
+	}
+	if err := callgraph.GraphVisitEdges(result.CallGraph, func(edge *callgraph.Edge) error {
+		callgraph.AddEdge(cg.CreateNode(edge.Caller.Func), edge.Site, cg.CreateNode(edge.Callee.Func))
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to walk edges: %w", err)
+	}
+	cg.DeleteSyntheticNodes()
 	return cg, nil
 }
 
-func (a *Analyzer) mainPackages(path string) ([]*ssa.Package, error) {
-	pkgs, err := a.loadPackage(path)
+// entryGroup is the main packages in the same module, which are loaded into one SSA program.
+type entryGroup struct {
+	dir      string
+	patterns []string
+}
+
+// groupEntries groups the paths of main packages by the module they belong to.
+func (a *Analyzer) groupEntries(service *Service, paths []string) ([]*entryGroup, error) {
+	root, err := filepath.Abs(RepoRoot(service))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get absolute path of %s: %w", RepoRoot(service), err)
+	}
+	groupMap := map[string]*entryGroup{}
+	groups := []*entryGroup{}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get absolute path of %s: %w", path, err)
+		}
+		dir := a.moduleRoot(root, path)
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get relative path of %s: %w", path, err)
+		}
+		group, exists := groupMap[dir]
+		if !exists {
+			group = &entryGroup{dir: dir}
+			groupMap[dir] = group
+			groups = append(groups, group)
+		}
+		group.patterns = append(group.patterns, "./"+filepath.ToSlash(rel))
+	}
+	return groups, nil
+}
+
+// moduleRoot returns the nearest directory containing go.mod from path, or root if not found.
+func (a *Analyzer) moduleRoot(root, path string) string {
+	for dir := path; strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		if dir == root {
+			break
+		}
+	}
+	return root
+}
+
+func (a *Analyzer) mainPackages(ctx context.Context, service *Service, group *entryGroup) ([]*ssa.Package, error) {
+	pkgs, err := a.loadPackage(ctx, service, group)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to load package: %w", err)
 	}
 	return a.filterMainPackages(pkgs), nil
 }
 
-func (a *Analyzer) loadPackage(path string) ([]*ssa.Package, error) {
+func (a *Analyzer) loadPackage(ctx context.Context, service *Service, group *entryGroup) ([]*ssa.Package, error) {
 	cfg := &packages.Config{
-		Mode:  packages.LoadAllSyntax,
-		Tests: false,
-		Dir:   path,
+		Context: ctx,
+		Mode:    packages.LoadAllSyntax,
+		Tests:   false,
+		Dir:     group.dir,
 	}
-	pkgs, err := packages.Load(cfg)
+	done := a.progress.start(service.Name, LoadStage)
+	pkgs, err := packages.Load(cfg, group.patterns...)
+	done(err)
 	if err != nil {
 		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// all entries are loaded at once, so skip only the entries which can't be loaded.
+	validPkgs := []*packages.Package{}
 	for _, pkg := range pkgs {
 		if len(pkg.Errors) > 0 {
-			return nil, nil
+			fmt.Fprintf(a.output, "skip %s: %s\n", pkg.PkgPath, pkg.Errors[0])
+			continue
 		}
+		validPkgs = append(validPkgs, pkg)
+	}
+	if len(validPkgs) == 0 {
+		return nil, nil
 	}
-	prog, allPkgs := ssautil.AllPackages(pkgs, 0)
+	done = a.progress.start(service.Name, BuildStage)
+	prog, allPkgs := ssautil.AllPackages(validPkgs, 0)
 	prog.Build()
+	done(nil)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return allPkgs, nil
 }
 
@@ -201,106 +578,141 @@ func (a *Analyzer) filterMainPackages(pkgs []*ssa.Package) []*ssa.Package {
 	return mains
 }
 
-func (a *Analyzer) removePkgPath(typ string) string {
-	splitted := strings.Split(typ, ".")
-	return splitted[len(splitted)-1]
+func (a *Analyzer) ssaFuncToSourceURL(service *Service, fn *ssa.Function) (string, error) {
+	if !fn.Pos().IsValid() {
+		return "", xerrors.Errorf("unknown position of %s", fn)
+	}
+	return a.positionToSourceURL(service, fn.Prog.Fset.Position(fn.Pos()))
 }
 
-func (a *Analyzer) ssaFuncToSourceURL(service *Service, fn *ssa.Function) (string, error) {
-	sig := fn.Signature
-	pos := fn.Prog.Fset.Position(sig.Recv().Pos())
-	if !strings.HasPrefix(SubPath(service, pos.Filename), "/") {
+func (a *Analyzer) positionToSourceURL(service *Service, pos token.Position) (string, error) {
+	if RelativePath(service, pos.Filename) == pos.Filename {
 		return "", xerrors.Errorf("invalid create subpath from %s", pos.Filename)
 	}
 	return fmt.Sprintf("%s#L%d", FileURL(service, pos.Filename), pos.Line), nil
 }
 
-func (a *Analyzer) ssaFuncToMethod(fn *ssa.Function) (*Method, error) {
-	sig := fn.Signature
+type detectedCall struct {
+	target *Method
+	path   []*callgraph.Edge
+	sites  []*callgraph.Edge
+}
 
-	var (
-		inputType  string
-		outputType string
-	)
-	params := sig.Params()
-	results := sig.Results()
-	if params.Len() > 1 {
-		inputType = a.removePkgPath(params.At(1).Type().String())
+// getDependencies walks the call graph breadth-first from the handler nodes and
+// consults the detectors for each edge to find outbound dependencies, keyed by the mangled name of the target.
+// The traversal doesn't enter the callee of the dependency.
+// Each of them has the shortest call path from the handler and all edges invoking the target.
+func (a *Analyzer) getDependencies(ctx *DetectContext, from []*callgraph.Node, edgeMap map[int][]*callgraph.Edge, skip func(*callgraph.Edge) bool) (map[string]*detectedCall, error) {
+	visited := map[int][]*callgraph.Edge{}
+	queue := []*callgraph.Node{}
+	for _, node := range from {
+		if _, exists := visited[node.ID]; exists {
+			continue
+		}
+		visited[node.ID] = []*callgraph.Edge{}
+		queue = append(queue, node)
 	}
-	if results.Len() > 1 {
-		outputType = a.removePkgPath(results.At(0).Type().String())
+	callMap := map[string]*detectedCall{}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, edge := range edgeMap[node.ID] {
+			if skip != nil && skip(edge) {
+				continue
+			}
+			calleePkgPath := nodeToPkgPath(edge.Callee)
+			if ctx.Service.Packages.Excludes(calleePkgPath) {
+				continue
+			}
+			ctx.Path = visited[node.ID]
+			targets, err := a.detect(ctx, edge)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to detect dependency: %w", err)
+			}
+			for _, target := range targets {
+				name := target.MangledName()
+				if call, exists := callMap[name]; exists {
+					call.sites = append(call.sites, edge)
+					call.target.Access = mergeAccess(call.target.Access, target.Access)
+				} else {
+					path := make([]*callgraph.Edge, 0, len(visited[node.ID])+1)
+					path = append(path, visited[node.ID]...)
+					path = append(path, edge)
+					callMap[name] = &detectedCall{
+						target: target,
+						path:   path,
+						sites:  []*callgraph.Edge{edge},
+					}
+				}
+			}
+			// the callee of the dependency is the client ( e.g. Twirp stubs sending requests by net/http ), so don't follow it.
+			if len(targets) != 0 || !ctx.Service.Packages.Includes(calleePkgPath) {
+				continue
+			}
+			to := edge.Callee
+			if _, exists := visited[to.ID]; exists {
+				continue
+			}
+			path := make([]*callgraph.Edge, 0, len(visited[node.ID])+1)
+			path = append(path, visited[node.ID]...)
+			path = append(path, edge)
+			visited[to.ID] = path
+			queue = append(queue, to)
+		}
 	}
-
-	generatedPath := fn.Pkg.Pkg.Path()
-	serviceName, err := a.cfg.ServiceNameByGeneratedPath(generatedPath)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to get service name by generated path: %w", err)
-	}
-	return &Method{
-		GeneratedPath: generatedPath,
-		Service:       serviceName,
-		Name:          fn.Name(),
-		InputType:     inputType,
-		OutputType:    outputType,
-	}, nil
+	return callMap, nil
 }
 
-func (a *Analyzer) getGRPCMethods(service *Service, protoGoRepo string, from *callgraph.Node, edgeMap map[int][]*callgraph.Node, nodeMap map[int]struct{}) map[int]*ssa.Function {
-	if _, exists := nodeMap[from.ID]; exists {
-		return nil
-	}
-	nodeMap[from.ID] = struct{}{}
-	nodes, exists := edgeMap[from.ID]
-	if !exists {
-		return nil
-	}
-	funcMap := map[int]*ssa.Function{}
-	for _, to := range nodes {
-		if a.isGRPCMethod(to, protoGoRepo) {
-			funcMap[to.ID] = to.Func
+// detect returns the targets found by the first detector which recognizes edge as an outbound dependency.
+func (a *Analyzer) detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	for _, detector := range a.detectors {
+		targets, err := detector.Detect(ctx, edge)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to detect by %s: %w", detector.Name(), err)
 		}
-		for k, v := range a.getGRPCMethods(service, protoGoRepo, to, edgeMap, nodeMap) {
-			funcMap[k] = v
+		if len(targets) != 0 {
+			return targets, nil
 		}
 	}
-	return funcMap
+	return nil, nil
 }
 
-func (a *Analyzer) isGRPCMethod(node *callgraph.Node, protoGoRepo string) bool {
-	path := a.nodeToPkgPath(node)
-	if !strings.Contains(path, protoGoRepo) {
-		return false
-	}
-	if node.Func.Name() == "" || !unicode.IsUpper(rune(node.Func.Name()[0])) {
-		return false
-	}
-	sig := node.Func.Signature
-	params := sig.Params()
-	results := sig.Results()
-	if params.Len() < 2 {
-		return false
-	}
-	if !strings.Contains(params.At(1).Pkg().Path(), protoGoRepo) {
-		return false
-	}
-	if results.Len() < 2 {
-		return false
-	}
-	if !strings.Contains(results.At(0).Pkg().Path(), protoGoRepo) {
-		return false
+func (a *Analyzer) edgesToCallSites(service *Service, path []*callgraph.Edge) []*CallSite {
+	sites := make([]*CallSite, 0, len(path))
+	for _, edge := range path {
+		site := &CallSite{
+			Caller:      edge.Caller.Func.String(),
+			Callee:      edge.Callee.Func.String(),
+			Conditional: isConditionalCall(edge.Site),
+			InLoop:      isCallInLoop(edge.Site),
+			Async:       isAsyncCall(edge.Site),
+		}
+		if pos := edge.Pos(); pos.IsValid() {
+			position := edge.Caller.Func.Prog.Fset.Position(pos)
+			site.File = RelativePath(service, position.Filename)
+			site.Line = position.Line
+			if url, err := a.positionToSourceURL(service, position); err == nil {
+				site.URL = url
+			}
+		}
+		sites = append(sites, site)
 	}
-	return true
+	return sites
 }
 
-func (a *Analyzer) nodeToPkgPath(node *callgraph.Node) string {
-	if node == nil {
-		return ""
-	}
-	if node.Func == nil {
-		return ""
-	}
-	if node.Func.Pkg == nil {
-		return ""
+// mergeCallSites appends sites to base, ignoring the call sites already contained.
+func (a *Analyzer) mergeCallSites(base []*CallSite, sites []*CallSite) []*CallSite {
+	for _, site := range sites {
+		var exists bool
+		for _, b := range base {
+			if b.Caller == site.Caller && b.File == site.File && b.Line == site.Line {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			base = append(base, site)
+		}
 	}
-	return node.Func.Pkg.Pkg.Path()
+	return base
 }
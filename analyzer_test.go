@@ -0,0 +1,352 @@
+package servicetracer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var (
+	orderProto = `package order
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type GetOrderRequest struct{ Id string }
+type GetOrderResponse struct{ UserName string }
+
+type OrderServiceServer interface {
+	GetOrder(context.Context, *GetOrderRequest) (*GetOrderResponse, error)
+}
+
+func RegisterOrderServiceServer(s grpc.ServiceRegistrar, srv OrderServiceServer) {
+	s.RegisterService(&OrderService_ServiceDesc, srv)
+}
+
+func _OrderService_GetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(OrderServiceServer).GetOrder(ctx, in)
+}
+
+var OrderService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "order.OrderService",
+	HandlerType: (*OrderServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetOrder", Handler: _OrderService_GetOrder_Handler},
+	},
+}
+`
+	userProto = `package user
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type GetUserRequest struct{ Id string }
+type GetUserResponse struct{ Name string }
+
+type UserServiceClient interface {
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error)
+}
+
+type userServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserServiceClient(cc grpc.ClientConnInterface) UserServiceClient {
+	return &userServiceClient{cc}
+}
+
+func (c *userServiceClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error) {
+	out := new(GetUserResponse)
+	if err := c.cc.Invoke(ctx, "/user.UserService/GetUser", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+`
+	orderServer = `package main
+
+import (
+	"context"
+
+	"github.com/example/proto/order"
+	"github.com/example/proto/user"
+	"google.golang.org/grpc"
+)
+
+type server struct {
+	user user.UserServiceClient
+}
+
+func (s *server) GetOrder(ctx context.Context, req *order.GetOrderRequest) (*order.GetOrderResponse, error) {
+	name, err := s.userName(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &order.GetOrderResponse{UserName: name}, nil
+}
+
+func (s *server) userName(ctx context.Context, id string) (string, error) {
+	resp, err := s.user.GetUser(ctx, &user.GetUserRequest{Id: id})
+	if err != nil {
+		return "", err
+	}
+	return resp.Name, nil
+}
+
+func main() {
+	conn, _ := grpc.Dial("user:443")
+	s := grpc.NewServer()
+	order.RegisterOrderServiceServer(s, &server{user: user.NewUserServiceClient(conn)})
+	s.Serve()
+}
+`
+)
+
+func orderFixtureConfig() *Config {
+	return &Config{
+		Services: []*Service{
+			fixtureService("order", &Method{
+				GeneratedPath: "github.com/example/proto/order",
+				Service:       "order",
+				Name:          "GetOrder",
+				InputType:     "GetOrderRequest",
+				OutputType:    "GetOrderResponse",
+				ProtoService:  "OrderService",
+			}),
+			fixtureService("user", &Method{
+				GeneratedPath: "github.com/example/proto/user",
+				Service:       "user",
+				Name:          "GetUser",
+				InputType:     "GetUserRequest",
+				OutputType:    "GetUserResponse",
+				ProtoService:  "UserService",
+			}),
+		},
+	}
+}
+
+// callSiteNames returns the call sites like "caller -> callee at file:line".
+func callSiteNames(sites []*CallSite) []string {
+	names := []string{}
+	for _, site := range sites {
+		names = append(names, fmt.Sprintf("%s -> %s at %s", site.Caller, site.Callee, site.Location()))
+	}
+	return names
+}
+
+func TestAnalyzeRecordsPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		server string
+		path   []string
+	}{
+		{
+			name:   "through helper",
+			server: orderServer,
+			path: []string{
+				"(*github.com/example/svc/cmd/server.server).GetOrder -> (*github.com/example/svc/cmd/server.server).userName at cmd/server/server.go:16",
+				"(*github.com/example/svc/cmd/server.server).userName -> (*github.com/example/proto/user.userServiceClient).GetUser at cmd/server/server.go:24",
+			},
+		},
+		{
+			name: "shortest path",
+			server: strings.Replace(orderServer, `name, err := s.userName(ctx, req.Id)`, `s.audit(ctx, req.Id)
+	name, err := s.userName(ctx, req.Id)`, 1) + `
+func (s *server) audit(ctx context.Context, id string) {
+	s.userName(ctx, id)
+}
+`,
+			path: []string{
+				"(*github.com/example/svc/cmd/server.server).GetOrder -> (*github.com/example/svc/cmd/server.server).userName at cmd/server/server.go:17",
+				"(*github.com/example/svc/cmd/server.server).userName -> (*github.com/example/proto/user.userServiceClient).GetUser at cmd/server/server.go:25",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			methodMap := analyzeFixture(t, orderFixtureConfig(), map[string]string{
+				"github.com/example/proto/order": orderProto,
+				"github.com/example/proto/user":  userProto,
+				fixtureRepo + "/cmd/server":      test.server,
+			})
+			analyzedMethod, exists := methodMap["order.getorder.getorderrequest.getorderresponse"]
+			if !exists {
+				t.Fatalf("GetOrder is not analyzed: %v", methodMap)
+			}
+			dep := analyzedMethod.Dependency(&Method{Service: "user", Name: "GetUser", InputType: "GetUserRequest", OutputType: "GetUserResponse"})
+			if dep == nil {
+				t.Fatalf("GetUser is not detected: %v", dependencyNames(analyzedMethod))
+			}
+			if diff := cmpStrings(test.path, callSiteNames(dep.Path)); diff != "" {
+				t.Errorf("unexpected path: %s", diff)
+			}
+			for _, site := range dep.Path {
+				if !strings.HasPrefix(site.URL, "https://github.com/example/svc/blob/master/cmd/server/server.go#L") {
+					t.Errorf("unexpected url %s", site.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeRecordsCallSites(t *testing.T) {
+	server := strings.Replace(orderServer, `name, err := s.userName(ctx, req.Id)`, `if _, err := s.user.GetUser(ctx, &user.GetUserRequest{Id: req.Id}); err != nil {
+		return nil, err
+	}
+	name, err := s.userName(ctx, req.Id)`, 1)
+	methodMap := analyzeFixture(t, orderFixtureConfig(), map[string]string{
+		"github.com/example/proto/order": orderProto,
+		"github.com/example/proto/user":  userProto,
+		fixtureRepo + "/cmd/server":      server,
+	})
+	analyzedMethod := methodMap["order.getorder.getorderrequest.getorderresponse"]
+	if analyzedMethod == nil || len(analyzedMethod.Dependencies) != 1 {
+		t.Fatalf("unexpected dependencies: %v", methodMap)
+	}
+	dep := analyzedMethod.Dependencies[0]
+	expected := []string{
+		"(*github.com/example/svc/cmd/server.server).GetOrder -> (*github.com/example/proto/user.userServiceClient).GetUser at cmd/server/server.go:16",
+		"(*github.com/example/svc/cmd/server.server).userName -> (*github.com/example/proto/user.userServiceClient).GetUser at cmd/server/server.go:27",
+	}
+	if diff := cmpStrings(expected, callSiteNames(dep.CallSites)); diff != "" {
+		t.Errorf("unexpected call sites: %s", diff)
+	}
+	if diff := cmpStrings(expected[:1], callSiteNames(dep.Path)); diff != "" {
+		t.Errorf("unexpected path: %s", diff)
+	}
+}
+
+func TestCreateCallGraphExcludesPackages(t *testing.T) {
+	mock := `package mock
+
+import (
+	"context"
+
+	"github.com/example/proto/user"
+	"google.golang.org/grpc"
+)
+
+type client struct{}
+
+func NewUserServiceClient() user.UserServiceClient {
+	return &client{}
+}
+
+func (c *client) GetUser(ctx context.Context, in *user.GetUserRequest, opts ...grpc.CallOption) (*user.GetUserResponse, error) {
+	return &user.GetUserResponse{Name: in.Id}, nil
+}
+`
+	server := strings.Replace(strings.Replace(orderServer, `"google.golang.org/grpc"
+)`, `"google.golang.org/grpc"
+	"github.com/example/svc/mock"
+)
+
+var fake bool`, 1), `order.RegisterOrderServiceServer(s, &server{user: user.NewUserServiceClient(conn)})`, `client := user.NewUserServiceClient(conn)
+	if fake {
+		client = mock.NewUserServiceClient()
+	}
+	order.RegisterOrderServiceServer(s, &server{user: client})`, 1)
+	cfg := orderFixtureConfig()
+	service := cfg.Services[0]
+	service.Packages.Exclude = []string{fixtureRepo + "/mock/..."}
+	mainPkgs := buildFixture(t, map[string]string{
+		"github.com/example/proto/order": orderProto,
+		"github.com/example/proto/user":  userProto,
+		fixtureRepo + "/mock":            mock,
+		fixtureRepo + "/cmd/server":      server,
+	})
+	cg, err := NewAnalyzer(cfg).createCallGraph(service, mainPkgs)
+	if err != nil {
+		t.Fatalf("failed to create callgraph: %+v", err)
+	}
+	mockFunc := mainPkgs[0].Prog.ImportedPackage(fixtureRepo + "/mock").Func("NewUserServiceClient")
+	if len(mockFunc.Blocks) == 0 {
+		t.Errorf("the body of the excluded function is removed")
+	}
+	userStubs := 0
+	for fn := range cg.Nodes {
+		if fn == nil || fn.Pkg == nil {
+			continue
+		}
+		switch fn.Pkg.Pkg.Path() {
+		case fixtureRepo + "/mock":
+			t.Errorf("the excluded function %s is in the callgraph", fn)
+		case "github.com/example/proto/user":
+			userStubs++
+		}
+	}
+	if userStubs == 0 {
+		t.Errorf("the real client isn't in the callgraph")
+	}
+}
+
+func TestAnalyzeWarnsAmbiguousHandler(t *testing.T) {
+	proto := orderProto + `
+type ArchiveServiceServer interface {
+	GetOrder(context.Context, *GetOrderRequest) (*GetOrderResponse, error)
+}
+`
+	newConfig := func() *Config {
+		cfg := orderFixtureConfig()
+		order := cfg.Services[0]
+		order.mtds = append(order.mtds, &Method{
+			GeneratedPath: "github.com/example/proto/order",
+			Service:       "order",
+			Name:          "GetOrder",
+			InputType:     "GetOrderRequest",
+			OutputType:    "GetOrderResponse",
+			ProtoService:  "ArchiveService",
+		})
+		for _, mtd := range order.mtds {
+			mtd.Pkg = "order"
+		}
+		return cfg
+	}
+	var (
+		firstOutput       string
+		firstDependencies []string
+	)
+	// the server implements both services, so the first one in order is chosen in every run.
+	for i := 0; i < 3; i++ {
+		var output bytes.Buffer
+		cfg := newConfig()
+		a := NewAnalyzer(cfg)
+		a.SetProgressReporter(&nopProgressReporter{})
+		a.SetMessageOutput(&output)
+		methodMap := analyzeFixtureWith(t, a, cfg, map[string]string{
+			"github.com/example/proto/order": proto,
+			"github.com/example/proto/user":  userProto,
+			fixtureRepo + "/cmd/server":      orderServer,
+		})
+		analyzedMethod, exists := methodMap["order.getorder.getorderrequest.getorderresponse"]
+		if !exists {
+			t.Fatalf("GetOrder is not analyzed: %v", methodMap)
+		}
+		expected := "warning: (*github.com/example/svc/cmd/server.server).GetOrder matches multiple methods ( order.ArchiveService/GetOrder, order.OrderService/GetOrder ). use order.ArchiveService/GetOrder\n"
+		if output.String() != expected {
+			t.Errorf("unexpected output %q", output.String())
+		}
+		dependencies := dependencyNames(analyzedMethod)
+		if i == 0 {
+			firstOutput, firstDependencies = output.String(), dependencies
+			continue
+		}
+		if output.String() != firstOutput {
+			t.Errorf("output differs from the first run: %q", output.String())
+		}
+		if diff := cmpStrings(firstDependencies, dependencies); diff != "" {
+			t.Errorf("dependencies differ from the first run: %s", diff)
+		}
+	}
+}
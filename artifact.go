@@ -0,0 +1,246 @@
+package servicetracer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"golang.org/x/xerrors"
+)
+
+// Artifact is the portable result of the analysis of a service ( e.g. published by CI of the service ).
+// Artifacts of all services are merged to render the system without cloning or analyzing them.
+type Artifact struct {
+	Metadata *CacheMetadata   `yaml:"metadata"`
+	Service  *ArtifactService `yaml:"service"`
+	Methods  MethodMap        `yaml:"methods"`
+}
+
+// ArtifactService is the analyzed service with the gRPC methods parsed from its proto,
+// so the artifact can be rendered without the proto repository.
+type ArtifactService struct {
+	Name    string    `yaml:"name"`
+	Repo    string    `yaml:"repo"`
+	Methods []*Method `yaml:"methods"`
+}
+
+// Write writes the artifact in JSON.
+func (a *Artifact) Write(w io.Writer) error {
+	b, err := yaml.MarshalWithOptions(a, yaml.JSON())
+	if err != nil {
+		return xerrors.Errorf("failed to marshal artifact: %w", err)
+	}
+	if _, err := w.Write(b); err != nil {
+		return xerrors.Errorf("failed to write artifact: %w", err)
+	}
+	return nil
+}
+
+// ReadArtifact reads the artifact written by Artifact.Write.
+func ReadArtifact(path string) (*Artifact, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read artifact: %w", err)
+	}
+	var artifact Artifact
+	if err := yaml.Unmarshal(file, &artifact); err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal artifact: %w", err)
+	}
+	if artifact.Service == nil {
+		return nil, xerrors.Errorf("%s has no service", path)
+	}
+	if reason := (&MethodMapCache{Metadata: artifact.Metadata}).Incompatibility(); reason != "" {
+		return nil, xerrors.Errorf("%s is incompatible ( %s )", path, reason)
+	}
+	return &artifact, nil
+}
+
+// AnalyzeService analyzes only the service named name and writes the artifact to output.
+// If repoDir isn't empty, it's analyzed instead of the clone of the repository ( e.g. the checkout in CI ).
+// The proto repositories of the other services are still cloned to detect the calls to them.
+func (t *ServiceTracer) AnalyzeService(ctx context.Context, name, repoDir, output string) error {
+	service := t.cfg.ServiceByName(name)
+	if service == nil {
+		return xerrors.Errorf("failed to find service %s", name)
+	}
+	service.repoDir = repoDir
+	if name, output, ok := isolatedAnalysis(); ok {
+		return t.runIsolated(ctx, name, output)
+	}
+	artifact, err := t.analyzeArtifact(ctx, service)
+	if err != nil {
+		return xerrors.Errorf("failed to analyze artifact: %w", err)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return xerrors.Errorf("failed to create %s: %w", output, err)
+	}
+	defer file.Close()
+	if err := artifact.Write(file); err != nil {
+		return xerrors.Errorf("failed to write artifact: %w", err)
+	}
+	return nil
+}
+
+func (t *ServiceTracer) analyzeArtifact(ctx context.Context, service *Service) (*Artifact, error) {
+	if err := CreateCacheDir(); err != nil {
+		return nil, xerrors.Errorf("failed to create cache dir: %w", err)
+	}
+	for _, s := range t.cfg.Services {
+		done := t.progress.start(s.Name, CloneStage)
+		var err error
+		if s == service && s.repoDir == "" {
+			err = CloneService(ctx, t.cfg, s, t.messageOutput())
+		} else {
+			err = CloneProto(ctx, t.cfg, s, t.messageOutput())
+		}
+		done(err)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to clone repository: %w", err)
+		}
+	}
+	methodMap, err := t.analyze(ctx, service)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to analyze: %w", err)
+	}
+	mtds, err := service.Methods()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get methods: %w", err)
+	}
+	return &Artifact{
+		Metadata: newCacheMetadata(service),
+		Service: &ArtifactService{
+			Name:    service.Name,
+			Repo:    service.Repo,
+			Methods: mtds,
+		},
+		Methods: methodMap,
+	}, nil
+}
+
+// Merge renders the system from the artifacts without cloning or analyzing services.
+// paths may be glob patterns like "artifacts/*.json".
+// Services of the artifacts not defined in the config are added, and services without artifacts are rendered as failed.
+// Each CI may name services differently, so the service of the artifact is found by the name or the repository,
+// and the gRPC methods are re-mapped to the services by the generated path.
+// The services are added and replaced in the copy of the config, so the config is kept for the next Merge or Run.
+func (t *ServiceTracer) Merge(paths []string) error {
+	artifacts, err := t.readArtifacts(paths)
+	if err != nil {
+		return xerrors.Errorf("failed to read artifacts: %w", err)
+	}
+	cfg := *t.cfg
+	cfg.Services = make([]*Service, 0, len(t.cfg.Services))
+	for _, service := range t.cfg.Services {
+		copied := *service
+		cfg.Services = append(cfg.Services, &copied)
+	}
+	failures := append([]*AnalysisFailure{}, t.failures...)
+	merged := map[*Service]struct{}{}
+	// keyMaps maps the keys of the method map of each artifact to the handlers renamed to the service of the config.
+	keyMaps := make([]map[string]*Method, len(artifacts))
+	for idx, artifact := range artifacts {
+		service := artifactService(&cfg, artifact)
+		if service == nil {
+			service = &Service{Name: artifact.Service.Name, Repo: artifact.Service.Repo}
+			cfg.Services = append(cfg.Services, service)
+		}
+		if _, exists := merged[service]; exists {
+			return xerrors.Errorf("duplicated artifacts of %s", service.Name)
+		}
+		merged[service] = struct{}{}
+		keyMaps[idx] = map[string]*Method{}
+		for _, mtd := range artifact.Service.Methods {
+			keyMaps[idx][mtd.MangledName()] = mtd
+			mtd.Service = service.Name
+		}
+		for _, v := range artifact.Methods {
+			if v.Entry != nil {
+				v.Entry.Service = service.Name
+			}
+		}
+		service.mtds = artifact.Service.Methods
+		if service.mtds == nil {
+			service.mtds = []*Method{}
+		}
+	}
+	for _, service := range cfg.Services {
+		if _, exists := merged[service]; exists {
+			continue
+		}
+		service.mtds = []*Method{}
+		failures = append(failures, &AnalysisFailure{
+			Service: service.Name,
+			Reason:  "no artifact",
+		})
+	}
+	methodMap := MethodMap{}
+	for idx, artifact := range artifacts {
+		if err := resolveServiceNames(&cfg, artifact.Methods); err != nil {
+			return xerrors.Errorf("failed to resolve service names: %w", err)
+		}
+		// the keys embed the service name of the artifact, so rebuild them with the renamed methods.
+		for k, v := range artifact.Methods {
+			key := k
+			if mtd, exists := keyMaps[idx][k]; exists {
+				key = mtd.MangledName()
+			} else if v.Entry != nil {
+				key = v.Entry.MangledName()
+			}
+			methodMap[key] = v
+		}
+	}
+	done := t.progress.start("", RenderStage)
+	err = NewRenderer(&cfg).Render(methodMap, failures...)
+	done(err)
+	if err != nil {
+		return xerrors.Errorf("failed to render method map: %w", err)
+	}
+	return nil
+}
+
+// artifactService returns the service of the config analyzed as the artifact.
+// If no service has the same name, the service having the same repository is used.
+func artifactService(cfg *Config, artifact *Artifact) *Service {
+	if service := cfg.ServiceByName(artifact.Service.Name); service != nil {
+		return service
+	}
+	if artifact.Service.Repo == "" {
+		return nil
+	}
+	for _, service := range cfg.Services {
+		if service.Repo == artifact.Service.Repo {
+			return service
+		}
+	}
+	return nil
+}
+
+func (t *ServiceTracer) readArtifacts(paths []string) ([]*Artifact, error) {
+	artifacts := []*Artifact{}
+	for _, path := range paths {
+		matches := []string{path}
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to glob %s: %w", path, err)
+			}
+		}
+		for _, match := range matches {
+			artifact, err := ReadArtifact(match)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to read artifact %s: %w", match, err)
+			}
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	if len(artifacts) == 0 {
+		return nil, xerrors.Errorf("no artifacts")
+	}
+	return artifacts, nil
+}
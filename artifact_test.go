@@ -0,0 +1,110 @@
+package servicetracer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeArtifact writes the artifact of the service analyzed in CI to dir.
+func writeArtifact(t *testing.T, dir string, service *Service, methodMap MethodMap) string {
+	t.Helper()
+	path := filepath.Join(dir, service.Name+".json")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	artifact := &Artifact{
+		Metadata: newCacheMetadata(service),
+		Service:  &ArtifactService{Name: service.Name, Repo: service.Repo, Methods: service.mtds},
+		Methods:  methodMap,
+	}
+	if err := artifact.Write(file); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMergeKeepsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service-tracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// CI of order names the service differently, and billing isn't defined in the config.
+	artifactCfg := orderFixtureConfig()
+	order, user := artifactCfg.Services[0], artifactCfg.Services[1]
+	order.Name = "order-api"
+	for _, mtd := range order.mtds {
+		mtd.Service = order.Name
+	}
+	paths := []string{
+		writeArtifact(t, dir, order, MethodMap{
+			order.mtds[0].MangledName(): &AnalyzedMethod{
+				Methods:      []*Method{user.mtds[0]},
+				Dependencies: []*Dependency{{Method: user.mtds[0]}},
+			},
+		}),
+		writeArtifact(t, dir, &Service{Name: "billing", Repo: "github.com/example/billing", mtds: []*Method{}}, MethodMap{}),
+	}
+
+	cfg := orderFixtureConfig()
+	cfg.Output = filepath.Join(dir, "trace")
+	cfg.Formats = []string{JSONFormat}
+	services := append([]*Service{}, cfg.Services...)
+	userMethods := cfg.Services[1].mtds
+	tracer := New(cfg)
+	tracer.SetProgressReporter(&nopProgressReporter{})
+
+	outputs := []string{}
+	for i := 0; i < 2; i++ {
+		if err := tracer.Merge(paths); err != nil {
+			t.Fatalf("failed to merge: %+v", err)
+		}
+		b, err := ioutil.ReadFile(cfg.Output + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, string(b))
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("merging again renders differently:\n%s\n%s", outputs[0], outputs[1])
+	}
+	var graph Graph
+	if err := json.Unmarshal([]byte(outputs[0]), &graph); err != nil {
+		t.Fatal(err)
+	}
+	failures := map[string]string{}
+	for _, service := range graph.Services {
+		failures[service.Name] = service.Failure
+	}
+	expected := map[string]string{"order": "", "user": "no artifact", "billing": ""}
+	if len(failures) != len(expected) {
+		t.Errorf("unexpected services: %v", failures)
+	}
+	for name, failure := range expected {
+		if actual, exists := failures[name]; !exists || actual != failure {
+			t.Errorf("unexpected failure of %s: %q", name, actual)
+		}
+	}
+
+	// the config is kept as is, so Run after Merge analyzes the services of the config.
+	if len(cfg.Services) != len(services) {
+		t.Fatalf("services are added to the config: %d", len(cfg.Services))
+	}
+	for i, service := range cfg.Services {
+		if service != services[i] {
+			t.Errorf("service %s is replaced", service.Name)
+		}
+	}
+	if len(cfg.Services[1].mtds) != len(userMethods) || cfg.Services[1].mtds[0] != userMethods[0] {
+		t.Errorf("methods of user are replaced: %v", cfg.Services[1].mtds)
+	}
+	if len(tracer.failures) != 0 {
+		t.Errorf("failures are recorded to the tracer: %v", tracer.failures)
+	}
+}
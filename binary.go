@@ -0,0 +1,73 @@
+package servicetracer
+
+import (
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// binaryMap maps the call graph nodes to the binaries reaching them.
+// All main packages of the module are analyzed at once, so this keeps which binary serves the method.
+type binaryMap map[*callgraph.Node][]string
+
+// reachableBinaries traverses the call graph from main and init of each main package.
+func (a *Analyzer) reachableBinaries(service *Service, cg *callgraph.Graph, mainPkgs []*ssa.Package) binaryMap {
+	binaries := binaryMap{}
+	for _, pkg := range mainPkgs {
+		name := a.binaryName(service, pkg)
+		visited := map[*callgraph.Node]struct{}{}
+		queue := []*callgraph.Node{}
+		for _, fn := range []*ssa.Function{pkg.Func("init"), pkg.Func("main")} {
+			if fn == nil {
+				continue
+			}
+			if node, exists := cg.Nodes[fn]; exists {
+				visited[node] = struct{}{}
+				queue = append(queue, node)
+			}
+		}
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			binaries[node] = append(binaries[node], name)
+			for _, edge := range node.Out {
+				if _, exists := visited[edge.Callee]; exists {
+					continue
+				}
+				visited[edge.Callee] = struct{}{}
+				queue = append(queue, edge.Callee)
+			}
+		}
+	}
+	return binaries
+}
+
+// of returns the binaries reaching some of nodes.
+func (m binaryMap) of(nodes []*callgraph.Node) []string {
+	binaries := []string{}
+	for _, node := range nodes {
+		for _, binary := range m[node] {
+			if !containsString(binaries, binary) {
+				binaries = append(binaries, binary)
+			}
+		}
+	}
+	sort.Strings(binaries)
+	return binaries
+}
+
+// binaryName returns the directory of the main package relative to the repository like "cmd/server".
+func (a *Analyzer) binaryName(service *Service, pkg *ssa.Package) string {
+	fn := pkg.Func("main")
+	if fn == nil || !fn.Pos().IsValid() {
+		return pkg.Pkg.Path()
+	}
+	dir := filepath.Dir(pkg.Prog.Fset.Position(fn.Pos()).Filename)
+	root, _ := filepath.Abs(RepoRoot(service))
+	if dir == root {
+		return "."
+	}
+	return RelativePath(service, dir)
+}
@@ -0,0 +1,79 @@
+package servicetracer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeRecordsBinaries(t *testing.T) {
+	worker := `package main
+
+import (
+	"context"
+
+	"github.com/example/proto/user"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	conn, _ := grpc.Dial("user:443")
+	user.NewUserServiceClient(conn).GetUser(context.Background(), &user.GetUserRequest{})
+}
+`
+	methodMap := analyzeFixture(t, orderFixtureConfig(), map[string]string{
+		"github.com/example/proto/order": orderProto,
+		"github.com/example/proto/user":  userProto,
+		fixtureRepo + "/cmd/server":      orderServer,
+		fixtureRepo + "/cmd/admin":       orderServer,
+		fixtureRepo + "/cmd/worker":      worker,
+	})
+	analyzedMethod, exists := methodMap["order.getorder.getorderrequest.getorderresponse"]
+	if !exists {
+		t.Fatalf("GetOrder is not analyzed: %v", methodMap)
+	}
+	// all mains are analyzed at once, but the handler is served only by the binaries reaching it.
+	if diff := cmpStrings([]string{"cmd/admin", "cmd/server"}, analyzedMethod.Binaries); diff != "" {
+		t.Errorf("unexpected binaries: %s", diff)
+	}
+}
+
+func TestGroupEntries(t *testing.T) {
+	root, err := ioutil.TempDir("", "service-tracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, file := range []string{"go.mod", "cmd/server/main.go", "cmd/worker/main.go", "tools/go.mod", "tools/cmd/gen/main.go"} {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := &Service{repoDir: root}
+	groups, err := NewAnalyzer(&Config{}).groupEntries(service, []string{
+		filepath.Join(root, "cmd/server"),
+		filepath.Join(root, "tools/cmd/gen"),
+		filepath.Join(root, "cmd/worker"),
+	})
+	if err != nil {
+		t.Fatalf("failed to group entries: %+v", err)
+	}
+	// the entries of the same module are loaded together, and the nested module is loaded separately.
+	expected := []string{
+		root + ": ./cmd/server, ./cmd/worker",
+		filepath.Join(root, "tools") + ": ./cmd/gen",
+	}
+	actual := []string{}
+	for _, group := range groups {
+		actual = append(actual, group.dir+": "+strings.Join(group.patterns, ", "))
+	}
+	if diff := cmpStrings(expected, actual); diff != "" {
+		t.Errorf("unexpected groups: %s", diff)
+	}
+}
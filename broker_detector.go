@@ -0,0 +1,142 @@
+package servicetracer
+
+import (
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	pubsubPkgPath  = "cloud.google.com/go/pubsub"
+	kafkaGoPkgPath = "github.com/segmentio/kafka-go"
+
+	pubsubBroker = "pubsub"
+	kafkaBroker  = "kafka"
+)
+
+var (
+	saramaPkgPaths = map[string]struct{}{
+		"github.com/Shopify/sarama": {},
+		"github.com/IBM/sarama":     {},
+	}
+)
+
+// BrokerDetector detects publishing messages to and subscribing messages from Kafka and Cloud Pub/Sub.
+//
+// Supported clients are cloud.google.com/go/pubsub, github.com/segmentio/kafka-go and github.com/Shopify/sarama.
+// Topic names are recovered from constants or config keys ( environment variables or viper ).
+// Cloud Pub/Sub consumers know only the subscription, so it is mapped to the topic by `subscriptions` of the service config.
+type BrokerDetector struct{}
+
+func (d *BrokerDetector) Name() string {
+	return "broker"
+}
+
+func (d *BrokerDetector) Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	if edge.Site == nil {
+		return nil, nil
+	}
+	fn := edge.Callee.Func
+	pkgPath := nodeToPkgPath(edge.Callee)
+	if nodeToPkgPath(edge.Caller) == pkgPath {
+		return nil, nil
+	}
+	args := callArgs(edge.Site, fn)
+	recv := callRecv(edge.Site)
+	switch {
+	case pkgPath == pubsubPkgPath && relFuncName(fn) == "(*Topic).Publish":
+		return []*Method{topicMethod(pubsubBroker, d.resolvePubSubID(recv, "(*Client).Topic", "(*Client).TopicInProject"))}, nil
+	case pkgPath == kafkaGoPkgPath && relFuncName(fn) == "(*Writer).WriteMessages":
+		topic, _ := resolveFieldString(recv, "Topic")
+		return []*Method{topicMethod(kafkaBroker, topic)}, nil
+	case d.isSarama(pkgPath) && relFuncName(fn) == "(*syncProducer).SendMessage":
+		topic, _ := resolveFieldString(args[0], "Topic")
+		return []*Method{topicMethod(kafkaBroker, topic)}, nil
+	case d.isSarama(pkgPath) && relFuncName(fn) == "(*syncProducer).SendMessages":
+		return []*Method{topicMethod(kafkaBroker, unresolvedPart)}, nil
+	}
+	return nil, nil
+}
+
+func (d *BrokerDetector) DetectEntry(ctx *DetectContext, edge *callgraph.Edge) ([]*Entry, error) {
+	if edge.Site == nil {
+		return nil, nil
+	}
+	fn := edge.Callee.Func
+	pkgPath := nodeToPkgPath(edge.Callee)
+	if nodeToPkgPath(edge.Caller) == pkgPath {
+		return nil, nil
+	}
+	args := callArgs(edge.Site, fn)
+	recv := callRecv(edge.Site)
+	switch {
+	case pkgPath == pubsubPkgPath && relFuncName(fn) == "(*Subscription).Receive":
+		subscription := d.resolvePubSubID(recv, "(*Client).Subscription", "(*Client).SubscriptionInProject")
+		topic, exists := ctx.Service.Subscriptions[subscription]
+		if !exists {
+			topic = subscription
+		}
+		return []*Entry{d.entry(ctx, edge, funcNodes(ctx.CallGraph, args[1]), topicMethod(pubsubBroker, topic))}, nil
+	case pkgPath == kafkaGoPkgPath && (relFuncName(fn) == "(*Reader).ReadMessage" || relFuncName(fn) == "(*Reader).FetchMessage"):
+		topic := unresolvedPart
+		if call := producerCall(recv); call != nil && call.StaticCallee() != nil && call.StaticCallee().Name() == "NewReader" {
+			topic, _ = resolveFieldString(call.Args[0], "Topic")
+		}
+		return []*Entry{d.entry(ctx, edge, nil, topicMethod(kafkaBroker, topic))}, nil
+	case d.isSarama(pkgPath) && relFuncName(fn) == "(*consumerGroup).Consume":
+		topics := []*Method{}
+		for _, topic := range resolveStrings(args[1]) {
+			topics = append(topics, topicMethod(kafkaBroker, topic))
+		}
+		return []*Entry{d.entry(ctx, edge, methodNodes(ctx.CallGraph, args[2], "ConsumeClaim"), topics...)}, nil
+	}
+	return nil, nil
+}
+
+// entry creates the consumer entry point named by the function subscribing the topics.
+// If the function handling messages isn't known, the traversal starts from the subscribing function.
+func (d *BrokerDetector) entry(ctx *DetectContext, edge *callgraph.Edge, roots []*callgraph.Node, topics ...*Method) *Entry {
+	if len(roots) == 0 {
+		roots = []*callgraph.Node{edge.Caller}
+	}
+	return &Entry{
+		Method: &Method{
+			Kind:    ConsumerMethodKind,
+			Service: ctx.Service.Name,
+			Name:    relFuncName(edge.Caller.Func),
+		},
+		Roots:         roots,
+		Subscriptions: topics,
+	}
+}
+
+func (d *BrokerDetector) isSarama(pkgPath string) bool {
+	_, exists := saramaPkgPaths[pkgPath]
+	return exists
+}
+
+// resolvePubSubID resolves the ID of the topic or the subscription created by client.Topic("id") or client.Subscription("id").
+func (d *BrokerDetector) resolvePubSubID(v ssa.Value, funcNames ...string) string {
+	call := producerCall(v)
+	if call == nil {
+		return unresolvedPart
+	}
+	fn := call.StaticCallee()
+	if fn == nil {
+		return unresolvedPart
+	}
+	for _, name := range funcNames {
+		if relFuncName(fn) == name {
+			id, _ := resolveString(call.Args[1])
+			return id
+		}
+	}
+	return unresolvedPart
+}
+
+func topicMethod(broker, topic string) *Method {
+	return &Method{
+		Kind:    TopicMethodKind,
+		Service: broker,
+		Name:    topic,
+	}
+}
@@ -0,0 +1,146 @@
+package servicetracer
+
+import (
+	"testing"
+)
+
+var brokerFixturePackages = map[string]string{
+	pubsubPkgPath: `package pubsub
+
+import "context"
+
+type Client struct{}
+
+func NewClient(ctx context.Context, projectID string) (*Client, error) { return &Client{}, nil }
+
+type Message struct {
+	Data []byte
+}
+
+type PublishResult struct{}
+
+type Topic struct {
+	id string
+}
+
+func (c *Client) Topic(id string) *Topic { return &Topic{id: id} }
+
+func (t *Topic) Publish(ctx context.Context, msg *Message) *PublishResult { return &PublishResult{} }
+
+type Subscription struct {
+	id string
+}
+
+func (c *Client) Subscription(id string) *Subscription { return &Subscription{id: id} }
+
+func (s *Subscription) Receive(ctx context.Context, f func(context.Context, *Message)) error {
+	f(ctx, &Message{})
+	return nil
+}
+`,
+	kafkaGoPkgPath: `package kafka
+
+import "context"
+
+type Message struct {
+	Value []byte
+}
+
+type Writer struct {
+	Topic string
+}
+
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error { return nil }
+
+type ReaderConfig struct {
+	Topic string
+}
+
+type Reader struct {
+	config ReaderConfig
+}
+
+func NewReader(config ReaderConfig) *Reader { return &Reader{config: config} }
+
+func (r *Reader) ReadMessage(ctx context.Context) (Message, error) { return Message{}, nil }
+`,
+	fixtureRepo + "/cmd/worker": `package main
+
+import (
+	"context"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/segmentio/kafka-go"
+)
+
+func publish(ctx context.Context, client *pubsub.Client) {
+	client.Topic("orders").Publish(ctx, &pubsub.Message{})
+}
+
+func subscribe(ctx context.Context, client *pubsub.Client) {
+	client.Subscription("order-sub").Receive(ctx, handle)
+}
+
+func handle(ctx context.Context, msg *pubsub.Message) {
+	w := &kafka.Writer{Topic: "order-events"}
+	w.WriteMessages(ctx, kafka.Message{Value: msg.Data})
+}
+
+func read(ctx context.Context) {
+	r := kafka.NewReader(kafka.ReaderConfig{Topic: "order-events"})
+	r.ReadMessage(ctx)
+}
+
+func main() {
+	ctx := context.Background()
+	client, _ := pubsub.NewClient(ctx, "project")
+	publish(ctx, client)
+	subscribe(ctx, client)
+	read(ctx)
+}
+`,
+}
+
+func TestBrokerDetector(t *testing.T) {
+	service := fixtureService("worker")
+	service.Subscriptions = map[string]string{"order-sub": "orders"}
+	methodMap := analyzeFixture(t, &Config{Services: []*Service{service}}, brokerFixturePackages)
+	tests := []struct {
+		name          string
+		subscriptions []string
+		dependencies  []string
+	}{
+		{
+			name:          "consumer:worker.subscribe",
+			subscriptions: []string{"pubsub orders"},
+			dependencies:  []string{"kafka order-events"},
+		},
+		{
+			name:          "consumer:worker.read",
+			subscriptions: []string{"kafka order-events"},
+			dependencies:  []string{},
+		},
+		{
+			name:         "caller:worker.cmd/worker.main",
+			dependencies: []string{"kafka order-events", "pubsub orders"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			analyzedMethod, exists := methodMap[test.name]
+			if !exists {
+				t.Fatalf("%s is not analyzed", test.name)
+			}
+			subscriptions := []string{}
+			for _, topic := range analyzedMethod.Subscriptions {
+				subscriptions = append(subscriptions, topic.DisplayName())
+			}
+			if diff := cmpStrings(test.subscriptions, subscriptions); diff != "" {
+				t.Errorf("unexpected subscriptions: %s", diff)
+			}
+			if diff := cmpStrings(test.dependencies, dependencyNames(analyzedMethod)); diff != "" {
+				t.Errorf("unexpected dependencies: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package servicetracer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/goccy/go-yaml"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// CacheSchemaVersion is the version of the format of the method map cache.
+	// Change it when the format changes incompatibly.
+	CacheSchemaVersion = 1
+	// AnalysisAlgorithm identifies how the method map is analyzed.
+	// Change it when the analysis finds different results to regenerate caches.
+	AnalysisAlgorithm = "pointer/rta:v1"
+	modulePath        = "github.com/goccy/go-service-tracer"
+	shortCommitLen    = 12
+)
+
+// MethodMapCache is the method map of the service cached at maps/<service>.yaml with the metadata.
+type MethodMapCache struct {
+	Metadata *CacheMetadata `yaml:"metadata"`
+	Methods  MethodMap      `yaml:"methods"`
+}
+
+// CacheMetadata describes how and when the method map was generated.
+type CacheMetadata struct {
+	SchemaVersion int    `yaml:"schema_version"`
+	TracerVersion string `yaml:"tracer_version"`
+	// Commits maps the repositories of the service to the commit analyzed.
+	Commits     map[string]string `yaml:"commits,omitempty"`
+	Algorithm   string            `yaml:"algorithm"`
+	GeneratedAt time.Time         `yaml:"generated_at"`
+}
+
+// Incompatibility returns the reason why the cache can't be used by this version of go-service-tracer.
+// It returns empty string if the cache is compatible.
+func (c *MethodMapCache) Incompatibility() string {
+	switch {
+	case c.Metadata == nil:
+		return "no metadata"
+	case c.Metadata.SchemaVersion != CacheSchemaVersion:
+		return fmt.Sprintf("schema version %d is not %d", c.Metadata.SchemaVersion, CacheSchemaVersion)
+	case c.Metadata.Algorithm != AnalysisAlgorithm:
+		return fmt.Sprintf("algorithm %s is not %s", c.Metadata.Algorithm, AnalysisAlgorithm)
+	}
+	return ""
+}
+
+// Staleness returns the reason why the cache doesn't reflect the service any more
+// ( e.g. go-service-tracer is upgraded or the repository of the service has new commits ).
+// It returns empty string if the cache is up to date.
+func (c *MethodMapCache) Staleness(service *Service) string {
+	if version := TracerVersion(); c.Metadata.TracerVersion != version {
+		return fmt.Sprintf("tracer version %s is not %s", c.Metadata.TracerVersion, version)
+	}
+	commits := serviceCommits(service)
+	repos := make([]string, 0, len(commits))
+	for repo := range commits {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		commit := commits[repo]
+		cached, exists := c.Metadata.Commits[repo]
+		if !exists {
+			return fmt.Sprintf("commit of %s is not recorded", repo)
+		}
+		if cached != commit {
+			return fmt.Sprintf("commit of %s is %s, not %s", repo, shortCommit(cached), shortCommit(commit))
+		}
+	}
+	return ""
+}
+
+// TracerVersion returns the version of go-service-tracer built into the binary.
+func TracerVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// RepoCommit returns the HEAD commit of the repository cloned at dir.
+func RepoCommit(dir string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", xerrors.Errorf("failed to open repository %s: %w", dir, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get HEAD of %s: %w", dir, err)
+	}
+	return head.Hash().String(), nil
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > shortCommitLen {
+		return commit[:shortCommitLen]
+	}
+	return commit
+}
+
+// serviceCommits returns the HEAD commits of the repositories of the service.
+func serviceCommits(service *Service) map[string]string {
+	commits := map[string]string{}
+	repos := map[string]string{service.Repo: RepoRoot(service)}
+	if service.Proto.Repo != "" {
+		repos[service.Proto.Repo] = ProtoRepoRoot(service)
+	}
+	for repo, dir := range repos {
+		// repositories not cloned by git ( e.g. copied by hand ) have no commit.
+		if commit, err := RepoCommit(dir); err == nil {
+			commits[repo] = commit
+		}
+	}
+	return commits
+}
+
+func newCacheMetadata(service *Service) *CacheMetadata {
+	return &CacheMetadata{
+		SchemaVersion: CacheSchemaVersion,
+		TracerVersion: TracerVersion(),
+		Commits:       serviceCommits(service),
+		Algorithm:     AnalysisAlgorithm,
+		GeneratedAt:   time.Now().UTC(),
+	}
+}
+
+// ReadMethodMapCache reads the method map cache at path.
+// The cache written before the metadata is introduced is read without metadata.
+func ReadMethodMapCache(path string) (*MethodMapCache, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read method map cache: %w", err)
+	}
+	var cache MethodMapCache
+	if err := yaml.Unmarshal(file, &cache); err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal method map cache: %w", err)
+	}
+	return &cache, nil
+}
+
+// writeMethodMapCache writes the method map of the service with the metadata to path.
+// It's written to the temporary file and renamed, so the interrupted write doesn't leave the broken cache.
+func writeMethodMapCache(path string, service *Service, methodMap MethodMap) error {
+	b, err := yaml.Marshal(&MethodMapCache{
+		Metadata: newCacheMetadata(service),
+		Methods:  methodMap,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to marshal method map: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return xerrors.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("failed to write method map file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return xerrors.Errorf("failed to close method map file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return xerrors.Errorf("failed to rename method map file: %w", err)
+	}
+	return nil
+}
+
+// CacheEntryKind is the kind of the data in the cache directory.
+type CacheEntryKind string
+
+const (
+	RepoCacheEntryKind CacheEntryKind = "repo"
+	MapCacheEntryKind  CacheEntryKind = "map"
+)
+
+// CacheEntry is the cloned repository or the method map cache in the cache directory.
+type CacheEntry struct {
+	Kind CacheEntryKind
+	// Path is relative to the cache directory ( e.g. service-a or maps/serviceA.yaml ).
+	Path string
+	// Commit is the HEAD commit of the repository. It's empty for the method map cache.
+	Commit string
+	// Cache is the method map cache. It's nil for the repository or the broken method map cache.
+	Cache   *MethodMapCache
+	ModTime time.Time
+}
+
+// Time returns when the entry was generated. The modification time is used if it isn't recorded.
+func (e *CacheEntry) Time() time.Time {
+	if e.Cache != nil && e.Cache.Metadata != nil {
+		return e.Cache.Metadata.GeneratedAt
+	}
+	return e.ModTime
+}
+
+// CacheEntries returns the repositories and the method map caches in the cache directory.
+func CacheEntries() ([]*CacheEntry, error) {
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("failed to read cache directory: %w", err)
+	}
+	entries := []*CacheEntry{}
+	for _, info := range infos {
+		if !info.IsDir() || info.Name() == filepath.Base(mapsDir()) {
+			continue
+		}
+		// repositories not cloned by git ( e.g. copied by hand ) have no commit.
+		commit, _ := RepoCommit(filepath.Join(cacheDir, info.Name()))
+		entries = append(entries, &CacheEntry{
+			Kind:    RepoCacheEntryKind,
+			Path:    info.Name(),
+			Commit:  commit,
+			ModTime: info.ModTime(),
+		})
+	}
+	infos, err = ioutil.ReadDir(mapsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("failed to read maps directory: %w", err)
+	}
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".yaml" {
+			continue
+		}
+		// the broken cache is listed without metadata to remove it.
+		cache, _ := ReadMethodMapCache(filepath.Join(mapsDir(), info.Name()))
+		entries = append(entries, &CacheEntry{
+			Kind:    MapCacheEntryKind,
+			Path:    filepath.ToSlash(filepath.Join(filepath.Base(mapsDir()), info.Name())),
+			Cache:   cache,
+			ModTime: info.ModTime(),
+		})
+	}
+	return entries, nil
+}
+
+// ListCache writes the repositories with their HEAD commit and the method map caches with their metadata.
+func (t *ServiceTracer) ListCache(w io.Writer) error {
+	entries, err := CacheEntries()
+	if err != nil {
+		return xerrors.Errorf("failed to get cache entries: %w", err)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tCOMMIT\tMODIFIED")
+	for _, entry := range entries {
+		if entry.Kind != RepoCacheEntryKind {
+			continue
+		}
+		commit := shortCommit(entry.Commit)
+		if commit == "" {
+			commit = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Path, commit, formatTime(entry.ModTime))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "MAP\tGENERATED\tTRACER\tALGORITHM\tSTATUS")
+	for _, entry := range entries {
+		if entry.Kind != MapCacheEntryKind {
+			continue
+		}
+		switch {
+		case entry.Cache == nil:
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\tbroken\n", entry.Path, formatTime(entry.ModTime))
+		case entry.Cache.Metadata == nil:
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\tincompatible ( %s )\n", entry.Path, formatTime(entry.ModTime), entry.Cache.Incompatibility())
+		default:
+			status := "ok"
+			if reason := entry.Cache.Incompatibility(); reason != "" {
+				status = fmt.Sprintf("incompatible ( %s )", reason)
+			}
+			metadata := entry.Cache.Metadata
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.Path, formatTime(metadata.GeneratedAt), metadata.TracerVersion, metadata.Algorithm, status)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return xerrors.Errorf("failed to write cache entries: %w", err)
+	}
+	return nil
+}
+
+// ShowCache writes the method map cache of the service in readable form.
+func (t *ServiceTracer) ShowCache(w io.Writer, name string) error {
+	path := filepath.Join(mapsDir(), fmt.Sprintf("%s.yaml", name))
+	cache, err := ReadMethodMapCache(path)
+	if err != nil {
+		return xerrors.Errorf("failed to read method map cache of %s: %w", name, err)
+	}
+	fmt.Fprintf(w, "%s ( %s )\n", name, path)
+	if metadata := cache.Metadata; metadata != nil {
+		fmt.Fprintf(w, "  schema version: %d\n", metadata.SchemaVersion)
+		fmt.Fprintf(w, "  tracer version: %s\n", metadata.TracerVersion)
+		fmt.Fprintf(w, "  algorithm: %s\n", metadata.Algorithm)
+		fmt.Fprintf(w, "  generated at: %s\n", formatTime(metadata.GeneratedAt))
+		repos := make([]string, 0, len(metadata.Commits))
+		for repo := range metadata.Commits {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		for _, repo := range repos {
+			fmt.Fprintf(w, "  commit: %s %s\n", repo, metadata.Commits[repo])
+		}
+	}
+	if reason := cache.Incompatibility(); reason != "" {
+		fmt.Fprintf(w, "  incompatible: %s\n", reason)
+		return nil
+	}
+	names := map[string]string{}
+	keys := make([]string, 0, len(cache.Methods))
+	for key, analyzedMethod := range cache.Methods {
+		names[key] = t.analyzedMethodName(name, key, analyzedMethod)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return names[keys[i]] < names[keys[j]]
+	})
+	for _, key := range keys {
+		analyzedMethod := cache.Methods[key]
+		fmt.Fprintf(w, "\n%s\n", names[key])
+		if analyzedMethod.SourceURL != "" {
+			fmt.Fprintf(w, "  source: %s\n", analyzedMethod.SourceURL)
+		}
+		if len(analyzedMethod.Binaries) != 0 {
+			fmt.Fprintf(w, "  binaries: %s\n", strings.Join(analyzedMethod.Binaries, ", "))
+		}
+		for _, topic := range analyzedMethod.Subscriptions {
+			fmt.Fprintf(w, "  subscribes: %s\n", topic.DisplayName())
+		}
+		for _, dep := range analyzedMethod.Dependencies {
+			fmt.Fprintf(w, "  depends on: %s (%s)\n", dep.Method.DisplayName(), strings.Join(dep.Labels(), ", "))
+		}
+	}
+	return nil
+}
+
+// analyzedMethodName returns the display name of the method cached by key.
+func (t *ServiceTracer) analyzedMethodName(serviceName, key string, analyzedMethod *AnalyzedMethod) string {
+	if analyzedMethod.Entry != nil {
+		return analyzedMethod.Entry.DisplayName()
+	}
+	for _, service := range t.cfg.Services {
+		if service.Name != serviceName {
+			continue
+		}
+		// proto files may not be cloned yet.
+		mtds, _ := service.Methods()
+		for _, mtd := range mtds {
+			if mtd.MangledName() == key {
+				return fmt.Sprintf("%s.%s", service.Name, mtd.Name)
+			}
+		}
+	}
+	return key
+}
+
+// RemoveCache removes the entries of the cache directory listed by ListCache ( e.g. service-a or maps/serviceA.yaml ).
+// If all is true, the cache directory is removed.
+func (t *ServiceTracer) RemoveCache(w io.Writer, paths []string, all bool) error {
+	if all {
+		if err := os.RemoveAll(cacheDir); err != nil {
+			return xerrors.Errorf("failed to remove cache directory: %w", err)
+		}
+		fmt.Fprintf(w, "removed %s\n", cacheDir)
+		return nil
+	}
+	entries, err := CacheEntries()
+	if err != nil {
+		return xerrors.Errorf("failed to get cache entries: %w", err)
+	}
+	entryMap := map[string]*CacheEntry{}
+	for _, entry := range entries {
+		entryMap[entry.Path] = entry
+	}
+	for _, path := range paths {
+		entry, exists := entryMap[filepath.ToSlash(filepath.Clean(path))]
+		if !exists {
+			return xerrors.Errorf("unknown cache entry %s", path)
+		}
+		if err := removeCacheEntry(w, entry); err != nil {
+			return xerrors.Errorf("failed to remove cache entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// PruneCache removes the entries generated before age ago.
+func (t *ServiceTracer) PruneCache(w io.Writer, age time.Duration) error {
+	entries, err := CacheEntries()
+	if err != nil {
+		return xerrors.Errorf("failed to get cache entries: %w", err)
+	}
+	threshold := time.Now().Add(-age)
+	for _, entry := range entries {
+		if !entry.Time().Before(threshold) {
+			continue
+		}
+		if err := removeCacheEntry(w, entry); err != nil {
+			return xerrors.Errorf("failed to remove cache entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func removeCacheEntry(w io.Writer, entry *CacheEntry) error {
+	if err := os.RemoveAll(filepath.Join(cacheDir, filepath.FromSlash(entry.Path))); err != nil {
+		return xerrors.Errorf("failed to remove %s: %w", entry.Path, err)
+	}
+	fmt.Fprintf(w, "removed %s\n", entry.Path)
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
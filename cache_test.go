@@ -0,0 +1,154 @@
+package servicetracer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupCacheDir changes the working directory to the temporary directory having the cache directory
+// with the repository service-a, the method map of order and the broken method map.
+// It returns the function to restore the working directory.
+func setupCacheDir(t *testing.T, cfg *Config) func() {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "service-tracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+	if err := CreateCacheDir(); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(cacheDir, "service-a"), 0755); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	order := cfg.Services[0]
+	methodMap := MethodMap{
+		"order.getorder.getorderrequest.getorderresponse": &AnalyzedMethod{
+			Dependencies: []*Dependency{{Method: cfg.Services[1].mtds[0]}},
+		},
+	}
+	if err := writeMethodMapCache(ServiceMapFile(order), order, methodMap); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mapsDir(), "broken.yaml"), []byte("methods: ["), 0644); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return cleanup
+}
+
+func TestListCache(t *testing.T) {
+	cfg := orderFixtureConfig()
+	defer setupCacheDir(t, cfg)()
+	var output bytes.Buffer
+	if err := New(cfg).ListCache(&output); err != nil {
+		t.Fatalf("failed to list cache: %+v", err)
+	}
+	// the repository not cloned by git has no commit.
+	expected := map[string]string{
+		"service-a":        "-",
+		"maps/broken.yaml": "broken",
+		"maps/order.yaml":  "ok",
+	}
+	for _, line := range strings.Split(output.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		status, exists := expected[fields[0]]
+		if !exists {
+			continue
+		}
+		delete(expected, fields[0])
+		// the commit of the repository is the second column, and the status of the map is the last one.
+		actual := fields[1]
+		if strings.HasPrefix(fields[0], "maps/") {
+			actual = fields[len(fields)-1]
+		}
+		if actual != status {
+			t.Errorf("unexpected %s: %s", fields[0], line)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("%v are not listed: %s", expected, output.String())
+	}
+}
+
+func TestShowCache(t *testing.T) {
+	cfg := orderFixtureConfig()
+	defer setupCacheDir(t, cfg)()
+	var output bytes.Buffer
+	if err := New(cfg).ShowCache(&output, "order"); err != nil {
+		t.Fatalf("failed to show cache: %+v", err)
+	}
+	// the method is shown by the name parsed from proto instead of the key.
+	expected := "\norder.GetOrder\n  depends on: user.GetUser (always)\n"
+	if !strings.HasSuffix(output.String(), expected) {
+		t.Errorf("unexpected output: %s", output.String())
+	}
+	if err := New(cfg).ShowCache(&output, "unknown"); err == nil {
+		t.Errorf("expected error for the service not cached")
+	}
+}
+
+func TestRemoveCache(t *testing.T) {
+	cfg := orderFixtureConfig()
+	defer setupCacheDir(t, cfg)()
+	var output bytes.Buffer
+	if err := New(cfg).RemoveCache(&output, []string{"maps/order.yaml"}, false); err != nil {
+		t.Fatalf("failed to remove cache: %+v", err)
+	}
+	if _, err := os.Stat(ServiceMapFile(cfg.Services[0])); !os.IsNotExist(err) {
+		t.Errorf("the method map isn't removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "service-a")); err != nil {
+		t.Errorf("the repository is removed: %v", err)
+	}
+	if err := New(cfg).RemoveCache(&output, []string{"maps/order.yaml"}, false); err == nil {
+		t.Errorf("expected error for the removed entry")
+	}
+	if err := New(cfg).RemoveCache(&output, nil, true); err != nil {
+		t.Fatalf("failed to remove all cache: %+v", err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("the cache directory isn't removed: %v", err)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	cfg := orderFixtureConfig()
+	defer setupCacheDir(t, cfg)()
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(cacheDir, "service-a"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	if err := New(cfg).PruneCache(&output, 24*time.Hour); err != nil {
+		t.Fatalf("failed to prune cache: %+v", err)
+	}
+	// the method map is kept because it's generated now even if the file is modified before.
+	if output.String() != "removed service-a\n" {
+		t.Errorf("unexpected output: %q", output.String())
+	}
+	if _, err := os.Stat(ServiceMapFile(cfg.Services[0])); err != nil {
+		t.Errorf("the method map is removed: %v", err)
+	}
+}
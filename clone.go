@@ -1,7 +1,10 @@
 package servicetracer
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/go-git/go-git/v5"
@@ -15,26 +18,51 @@ func cloneURL(token, repo string) string {
 	return fmt.Sprintf("https://%s.git", repo)
 }
 
-func clone(cloneDir, repo, url string) error {
+func clone(ctx context.Context, cloneDir, repo, url string, w io.Writer) error {
 	if _, err := os.Stat(cloneDir); err == nil {
 		return nil
 	}
-	fmt.Printf("cloning %s...\n", repo)
-	if _, err := git.PlainClone(cloneDir, false, &git.CloneOptions{URL: url, Progress: os.Stdout}); err != nil {
+	fmt.Fprintf(w, "cloning %s...\n", repo)
+	if _, err := git.PlainCloneContext(ctx, cloneDir, false, &git.CloneOptions{URL: url, Progress: w}); err != nil {
 		return xerrors.Errorf("failed to clone repository %s: %w", url, err)
 	}
 	return nil
 }
 
 func CloneRepository(cfg *Config) error {
-	token := cfg.AuthToken()
 	for _, service := range cfg.Services {
-		if err := clone(RepoRoot(service), service.Repo, cloneURL(token, service.Repo)); err != nil {
-			return xerrors.Errorf("failed to clone repository %s: %w", service.Repo, err)
-		}
-		if err := clone(ProtoRepoRoot(service), service.Proto.Repo, cloneURL(token, service.Proto.Repo)); err != nil {
-			return xerrors.Errorf("failed to clone repository %s: %w", service.Proto.Repo, err)
+		if err := CloneService(context.Background(), cfg, service, os.Stdout); err != nil {
+			return xerrors.Errorf("failed to clone service %s: %w", service.Name, err)
 		}
 	}
 	return nil
 }
+
+// CloneService clones the repository and the proto repository of the service if they aren't cloned yet.
+// The progress of git is written to w.
+func CloneService(ctx context.Context, cfg *Config, service *Service, w io.Writer) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	if err := clone(ctx, RepoRoot(service), service.Repo, cloneURL(cfg.AuthToken(), service.Repo), w); err != nil {
+		return xerrors.Errorf("failed to clone repository %s: %w", service.Repo, err)
+	}
+	if err := CloneProto(ctx, cfg, service, w); err != nil {
+		return xerrors.Errorf("failed to clone proto repository: %w", err)
+	}
+	return nil
+}
+
+// CloneProto clones only the proto repository of the service if it isn't cloned yet.
+func CloneProto(ctx context.Context, cfg *Config, service *Service, w io.Writer) error {
+	if service.Proto.Repo == "" {
+		return nil
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	if err := clone(ctx, ProtoRepoRoot(service), service.Proto.Repo, cloneURL(cfg.AuthToken(), service.Proto.Repo), w); err != nil {
+		return xerrors.Errorf("failed to clone repository %s: %w", service.Proto.Repo, err)
+	}
+	return nil
+}
@@ -1,20 +1,123 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	servicetracer "github.com/goccy/go-service-tracer"
 	"github.com/jessevdk/go-flags"
 	"golang.org/x/xerrors"
 )
 
-func _main(args []string, opt *servicetracer.Option) error {
+type explainCommand struct {
+	Args struct {
+		From string `description:"dependent method ( e.g. serviceA.GetUser )" positional-arg-name:"service.Method" required:"yes"`
+		To   string `description:"depended method ( e.g. serviceB.GetProfile )" positional-arg-name:"target.Method" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+type analyzeCommand struct {
+	Service  string `description:"service name to analyze ( e.g. serviceA )" long:"service" required:"true"`
+	RepoDir  string `description:"analyze the checkout of the repository instead of cloning it ( e.g. . )" long:"repo-dir"`
+	Artifact string `description:"specify artifact path ( default: <service>.json )" long:"artifact"`
+}
+
+type mergeCommand struct {
+	Args struct {
+		Artifacts []string `description:"artifacts written by analyze ( e.g. artifacts/*.json )" positional-arg-name:"artifact" required:"1"`
+	} `positional-args:"yes"`
+}
+
+type cacheCommand struct{}
+
+type cacheListCommand struct{}
+
+type cacheShowCommand struct {
+	Args struct {
+		Service string `description:"service name ( e.g. serviceA )" positional-arg-name:"service" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+type cacheRemoveCommand struct {
+	All  bool `description:"remove all cached data" long:"all"`
+	Args struct {
+		Entries []string `description:"entry listed by ls ( e.g. service-a or maps/serviceA.yaml )" positional-arg-name:"entry"`
+	} `positional-args:"yes"`
+}
+
+type cachePruneCommand struct {
+	OlderThan time.Duration `description:"remove entries older than the duration ( e.g. 720h )" long:"older-than" required:"true"`
+}
+
+var (
+	explainCmd     explainCommand
+	analyzeCmd     analyzeCommand
+	mergeCmd       mergeCommand
+	cacheCmd       cacheCommand
+	cacheListCmd   cacheListCommand
+	cacheShowCmd   cacheShowCommand
+	cacheRemoveCmd cacheRemoveCommand
+	cachePruneCmd  cachePruneCommand
+)
+
+func _main(ctx context.Context, cmd *flags.Command, args []string, opt *servicetracer.Option) error {
+	if opt.Config == "" && (cmd == nil || cmd.Name != "merge") {
+		return xerrors.Errorf("the required flag `-c, --config' was not specified")
+	}
 	cfg, err := servicetracer.LoadConfig(opt)
 	if err != nil {
 		return xerrors.Errorf("failed to load config: %w", err)
 	}
-	if err := servicetracer.New(cfg).Run(); err != nil {
-		return xerrors.Errorf("failed to service trace: %w", err)
+	tracer := servicetracer.New(cfg)
+	if cmd == nil {
+		if err := tracer.RunContext(ctx); err != nil {
+			return xerrors.Errorf("failed to service trace: %w", err)
+		}
+		return nil
+	}
+	switch cmd.Name {
+	case "explain":
+		if err := tracer.ExplainContext(ctx, os.Stdout, explainCmd.Args.From, explainCmd.Args.To); err != nil {
+			return xerrors.Errorf("failed to explain dependency: %w", err)
+		}
+	case "analyze":
+		artifact := analyzeCmd.Artifact
+		if artifact == "" {
+			artifact = fmt.Sprintf("%s.json", analyzeCmd.Service)
+		}
+		if err := tracer.AnalyzeService(ctx, analyzeCmd.Service, analyzeCmd.RepoDir, artifact); err != nil {
+			return xerrors.Errorf("failed to analyze service: %w", err)
+		}
+	case "merge":
+		if err := tracer.Merge(mergeCmd.Args.Artifacts); err != nil {
+			return xerrors.Errorf("failed to merge artifacts: %w", err)
+		}
+	case "cache":
+		if err := runCacheCommand(tracer, cmd.Active); err != nil {
+			return xerrors.Errorf("failed to run cache command: %w", err)
+		}
+	}
+	return nil
+}
+
+func runCacheCommand(tracer *servicetracer.ServiceTracer, cmd *flags.Command) error {
+	switch cmd.Name {
+	case "ls":
+		return tracer.ListCache(os.Stdout)
+	case "show":
+		return tracer.ShowCache(os.Stdout, cacheShowCmd.Args.Service)
+	case "rm":
+		if !cacheRemoveCmd.All && len(cacheRemoveCmd.Args.Entries) == 0 {
+			return xerrors.Errorf("specify entries to remove or --all")
+		}
+		return tracer.RemoveCache(os.Stdout, cacheRemoveCmd.Args.Entries, cacheRemoveCmd.All)
+	case "prune":
+		return tracer.PruneCache(os.Stdout, cachePruneCmd.OlderThan)
 	}
 	return nil
 }
@@ -22,11 +125,66 @@ func _main(args []string, opt *servicetracer.Option) error {
 func main() {
 	var opt servicetracer.Option
 	parser := flags.NewParser(&opt, flags.Default)
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddCommand(
+		"explain",
+		"show call path of dependency",
+		"show the shortest call path from a gRPC handler to the client stub of the depended method",
+		&explainCmd,
+	); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	if _, err := parser.AddCommand(
+		"analyze",
+		"analyze a service into artifact",
+		"analyze only the service and write the portable artifact to merge ( e.g. in CI of the service )",
+		&analyzeCmd,
+	); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	if _, err := parser.AddCommand(
+		"merge",
+		"render artifacts",
+		"merge the artifacts written by analyze and render them without cloning or analyzing services",
+		&mergeCmd,
+	); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	cache, err := parser.AddCommand(
+		"cache",
+		"manage cached data",
+		"list, show and remove the cloned repositories and the analysis maps in .service-tracer-cache",
+		&cacheCmd,
+	)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	for _, sub := range []struct {
+		name, short, long string
+		data              interface{}
+	}{
+		{"ls", "list cached data", "list the cloned repositories with their HEAD commit and the analysis maps with their metadata", &cacheListCmd},
+		{"show", "show analysis map", "show the analysis map of the service in readable form", &cacheShowCmd},
+		{"rm", "remove cached data", "remove the entries listed by ls or all cached data", &cacheRemoveCmd},
+		{"prune", "remove old cached data", "remove the entries older than the given age", &cachePruneCmd},
+	} {
+		if _, err := cache.AddCommand(sub.name, sub.short, sub.long, sub.data); err != nil {
+			log.Fatalf("%+v", err)
+		}
+	}
 	args, err := parser.Parse()
 	if err != nil {
 		return
 	}
-	if err := _main(args, &opt); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	if err := _main(ctx, parser.Active, args, &opt); err != nil {
 		log.Fatalf("%+v", err)
 	}
 }
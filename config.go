@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"golang.org/x/xerrors"
@@ -17,37 +18,205 @@ import (
 type MethodMap map[string]*AnalyzedMethod
 
 type AnalyzedMethod struct {
-	SourceURL string
-	Methods   []*Method
+	SourceURL    string
+	Methods      []*Method
+	Dependencies []*Dependency `yaml:"dependencies"`
+	// Entry is the entry point other than gRPC handler like message consumer. It is nil for gRPC handlers.
+	Entry *Method `yaml:"entry,omitempty"`
+	// Subscriptions are the topics consumed by Entry.
+	Subscriptions []*Method `yaml:"subscriptions,omitempty"`
+	// Binaries are the main packages reaching the method like "cmd/server".
+	Binaries []string `yaml:"binaries,omitempty"`
 }
 
+// Tables returns the database tables accessed by the method.
+func (m *AnalyzedMethod) Tables() []*Method {
+	tables := []*Method{}
+	for _, mtd := range m.Methods {
+		if mtd.Kind == TableMethodKind {
+			tables = append(tables, mtd)
+		}
+	}
+	return tables
+}
+
+func (m *AnalyzedMethod) callsGRPC() bool {
+	for _, mtd := range m.Methods {
+		if mtd.IsGRPC() {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribes reports whether the entry point consumes the topic.
+func (m *AnalyzedMethod) Subscribes(topic *Method) bool {
+	return containsMethod(m.Subscriptions, topic)
+}
+
+func containsMethod(mtds []*Method, mtd *Method) bool {
+	for _, m := range mtds {
+		if m.MangledName() == mtd.MangledName() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *AnalyzedMethod) Dependency(mtd *Method) *Dependency {
+	for _, dep := range m.Dependencies {
+		if dep.Method.MangledName() == mtd.MangledName() {
+			return dep
+		}
+	}
+	return nil
+}
+
+// Dependency explains why a handler depends on the method.
+// Path is the shortest call chain from the handler to the client stub,
+// and CallSites are all places reachable from the handler that invoke the client stub.
+//
+// Conditional is true if some call on Path may be skipped.
+// InLoop and Async are true if some call on Path or some of CallSites is called in a loop or in a new goroutine.
+// Interceptor is the name of the gRPC interceptor function if the method is called by the interceptor.
+type Dependency struct {
+	Method      *Method     `yaml:"method"`
+	Path        []*CallSite `yaml:"path"`
+	CallSites   []*CallSite `yaml:"call_sites"`
+	Conditional bool        `yaml:"conditional"`
+	InLoop      bool        `yaml:"in_loop"`
+	Async       bool        `yaml:"async"`
+	Interceptor string      `yaml:"interceptor,omitempty"`
+}
+
+// Always reports whether the method is called synchronously every time the handler succeeds.
+func (d *Dependency) Always() bool {
+	return !d.Conditional && !d.Async
+}
+
+// Labels returns the call properties of the dependency.
+func (d *Dependency) Labels() []string {
+	labels := []string{}
+	if d.Always() {
+		labels = append(labels, "always")
+	}
+	if d.Conditional {
+		labels = append(labels, "conditional")
+	}
+	if d.InLoop {
+		labels = append(labels, "in-loop")
+	}
+	if d.Async {
+		labels = append(labels, "async")
+	}
+	if d.Interceptor != "" {
+		labels = append(labels, "interceptor")
+	}
+	return labels
+}
+
+func (d *Dependency) classify() {
+	d.Conditional, d.InLoop, d.Async = false, false, false
+	for _, site := range d.Path {
+		d.Conditional = d.Conditional || site.Conditional
+		d.InLoop = d.InLoop || site.InLoop
+		d.Async = d.Async || site.Async
+	}
+	for _, site := range d.CallSites {
+		d.InLoop = d.InLoop || site.InLoop
+		d.Async = d.Async || site.Async
+	}
+}
+
+type CallSite struct {
+	Caller      string `yaml:"caller"`
+	Callee      string `yaml:"callee"`
+	File        string `yaml:"file"`
+	Line        int    `yaml:"line"`
+	URL         string `yaml:"url,omitempty"`
+	Conditional bool   `yaml:"conditional,omitempty"`
+	InLoop      bool   `yaml:"in_loop,omitempty"`
+	Async       bool   `yaml:"async,omitempty"`
+}
+
+func (s *CallSite) Location() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+const (
+	HTMLFormat     = "html"
+	JSONFormat     = "json"
+	DOTFormat      = "dot"
+	MermaidFormat  = "mermaid"
+	PlantUMLFormat = "plantuml"
+	SVGFormat      = "svg"
+	PNGFormat      = "png"
+	PDFFormat      = "pdf"
+)
+
 type Option struct {
-	Config string `description:"specify config path" short:"c" long:"config" required:"true"`
-	Output string `description:"specify output name" short:"o" long:"output" default:"trace"`
+	Config      string        `description:"specify config path ( optional for merge )" short:"c" long:"config"`
+	Output      string        `description:"specify output name" short:"o" long:"output" default:"trace"`
+	Format      []string      `description:"specify output format ( repeatable )" long:"format" choice:"html" choice:"json" choice:"dot" choice:"mermaid" choice:"plantuml" choice:"svg" choice:"png" choice:"pdf" default:"html"`
+	Timeout     time.Duration `description:"specify default timeout of analysis per service ( e.g. 30m )" long:"timeout"`
+	Progress    string        `description:"specify format of progress" long:"progress" choice:"text" choice:"json" default:"text"`
+	Isolate     bool          `description:"analyze each service in a child process" long:"isolate"`
+	MemoryLimit string        `description:"specify default memory limit of isolated analysis per service ( e.g. 8GiB )" long:"memory-limit"`
 }
 
 type Config struct {
 	Auth     Auth       `yaml:"auth"`
 	Services []*Service `yaml:"services"`
 	Output   string     `yaml:"-"`
+	// Formats are the output formats ( e.g. html and json ).
+	Formats []string `yaml:"-"`
+	// Timeout is the default timeout of analysis per service. Zero means no timeout.
+	Timeout time.Duration `yaml:"-"`
+	// Progress is the format of progress ( text or json ).
+	Progress string `yaml:"-"`
+	// Isolate analyzes each service in a child process so that crashes don't stop the other services.
+	Isolate bool `yaml:"-"`
+	// MemoryLimit is the default memory limit of isolated analysis in bytes. Zero means no limit.
+	MemoryLimit uint64 `yaml:"-"`
 }
 
+// ServiceNameByGeneratedPath returns the name of the service whose methods are generated into path.
+// It returns path itself if no services are found.
 func (c *Config) ServiceNameByGeneratedPath(path string) (string, error) {
+	service, err := c.serviceByGeneratedPath(path)
+	if err != nil {
+		return "", xerrors.Errorf("failed to find service: %w", err)
+	}
+	if service == nil {
+		return path, nil
+	}
+	return service.Name, nil
+}
+
+// serviceByGeneratedPath returns the service whose methods are generated into path, or nil if not found.
+func (c *Config) serviceByGeneratedPath(path string) (*Service, error) {
 	for _, service := range c.Services {
 		mtds, err := service.Methods()
 		if err != nil {
-			return "", xerrors.Errorf("failed to get methods: %w", err)
-		}
-		if len(mtds) == 0 {
-			continue
+			return nil, xerrors.Errorf("failed to get methods: %w", err)
 		}
 		for _, mtd := range mtds {
 			if mtd.GeneratedPath == path {
-				return service.Name, nil
+				return service, nil
 			}
 		}
 	}
-	return path, nil
+	return nil, nil
+}
+
+// ServiceByName returns the service named name. It returns nil if the service isn't defined.
+func (c *Config) ServiceByName(name string) *Service {
+	for _, service := range c.Services {
+		if service.Name == name {
+			return service
+		}
+	}
+	return nil
 }
 
 func (c *Config) AuthToken() string {
@@ -66,11 +235,31 @@ type Token struct {
 }
 
 type Service struct {
-	Name  string    `yaml:"name"`
-	Repo  string    `yaml:"repo"`
-	Entry string    `yaml:"entry"`
-	Proto Proto     `yaml:"proto"`
-	mtds  []*Method `yaml:"-"`
+	Name  string `yaml:"name"`
+	Repo  string `yaml:"repo"`
+	Entry string `yaml:"entry"`
+	Proto Proto  `yaml:"proto"`
+	// Domain clusters the service with the other services of the same domain in the overview like "payment".
+	Domain string `yaml:"domain"`
+	// Subscriptions maps Cloud Pub/Sub subscription to the topic.
+	Subscriptions map[string]string `yaml:"subscriptions"`
+	// Roots are the functions traversed as entry points of the caller-only service
+	// like "github.com/org/jobs/cmd/cleanup.run" or "(*github.com/org/jobs/worker.Worker).Run".
+	// If empty, main functions of the service having no proto are used.
+	Roots []string `yaml:"roots"`
+	// AnalysisRoots are the functions main doesn't reach without reflection like constructors provided to DI containers.
+	// The function is specified like "github.com/org/svc/server.NewServer",
+	// and all methods of the type are specified like "*github.com/org/svc/server.Server".
+	AnalysisRoots []string `yaml:"analysis_roots"`
+	// Timeout is the timeout of analysis like "30m". It overrides the default timeout given by --timeout.
+	Timeout string `yaml:"timeout"`
+	// MemoryLimit is the memory limit of the isolated analysis like "8GiB". It overrides the default limit given by --memory-limit.
+	MemoryLimit string `yaml:"memory_limit"`
+	// Packages restricts the packages traversed from the handlers and the implementations considered by the analysis.
+	Packages Packages  `yaml:"packages"`
+	mtds     []*Method `yaml:"-"`
+	// repoDir is the checkout of the repository used instead of the clone ( e.g. analyzed in CI of the service ).
+	repoDir string `yaml:"-"`
 }
 
 var (
@@ -166,6 +355,35 @@ func (s *Service) MethodNameMap() (map[string][]*Method, error) {
 	return nameMap, nil
 }
 
+// AnalysisTimeout returns the timeout of analysis. defaultTimeout is used if the service doesn't specify it.
+func (s *Service) AnalysisTimeout(defaultTimeout time.Duration) (time.Duration, error) {
+	if s.Timeout == "" {
+		return defaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to parse timeout %s: %w", s.Timeout, err)
+	}
+	return timeout, nil
+}
+
+// AnalysisMemoryLimit returns the memory limit of the isolated analysis. defaultLimit is used if the service doesn't specify it.
+func (s *Service) AnalysisMemoryLimit(defaultLimit uint64) (uint64, error) {
+	if s.MemoryLimit == "" {
+		return defaultLimit, nil
+	}
+	limit, err := parseBytes(s.MemoryLimit)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to parse memory limit %s: %w", s.MemoryLimit, err)
+	}
+	return limit, nil
+}
+
+// IsCallerOnly reports whether the service serves no RPCs declared in proto files.
+func (s *Service) IsCallerOnly() bool {
+	return len(s.Proto.Path) == 0
+}
+
 func (s *Service) RepoName() string {
 	paths := strings.Split(s.Repo, "/")
 	return paths[len(paths)-1]
@@ -184,39 +402,185 @@ func (s *Service) ProtoPaths() []string {
 	return paths
 }
 
+// Packages are the package patterns like "github.com/org/svc/..." ( "..." matches any string ).
+// Calls into the packages matched by Exclude are ignored, and their functions are removed from the call graph
+// ( e.g. fake clients or in-memory implementations wired behind flags ).
+// If Include is not empty, only functions in the packages matched by Include are traversed,
+// but calls to the other packages are still detected as dependencies.
+type Packages struct {
+	Include  []string `yaml:"include"`
+	Exclude  []string `yaml:"exclude"`
+	includes []*regexp.Regexp
+	excludes []*regexp.Regexp
+}
+
+// Includes reports whether the functions in the package are traversed.
+func (p *Packages) Includes(pkgPath string) bool {
+	if len(p.Include) == 0 || pkgPath == "" {
+		return true
+	}
+	if p.includes == nil {
+		p.includes = compilePackagePatterns(p.Include)
+	}
+	return matchPackagePatterns(p.includes, pkgPath)
+}
+
+// Excludes reports whether the package is out of the analysis scope.
+func (p *Packages) Excludes(pkgPath string) bool {
+	if len(p.Exclude) == 0 || pkgPath == "" {
+		return false
+	}
+	if p.excludes == nil {
+		p.excludes = compilePackagePatterns(p.Exclude)
+	}
+	return matchPackagePatterns(p.excludes, pkgPath)
+}
+
+// compilePackagePatterns compiles the patterns like go command, so "x/..." matches x and its subpackages.
+func compilePackagePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := strings.Replace(regexp.QuoteMeta(pattern), `\.\.\.`, `.*`, -1)
+		if strings.HasSuffix(expr, `/.*`) {
+			expr = strings.TrimSuffix(expr, `/.*`) + `(/.*)?`
+		}
+		compiled = append(compiled, regexp.MustCompile(fmt.Sprintf("^%s$", expr)))
+	}
+	return compiled
+}
+
+func matchPackagePatterns(patterns []*regexp.Regexp, pkgPath string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(pkgPath) {
+			return true
+		}
+	}
+	return false
+}
+
 type Proto struct {
 	Repo string   `yaml:"repo"`
 	Path []string `yaml:"path"`
 }
 
+const (
+	// GRPCMethodKind is the kind of methods declared in proto files.
+	GRPCMethodKind = ""
+	// HTTPMethodKind is the kind of HTTP endpoints.
+	// Service is the host and Name is the HTTP method and path like "GET /v1/users".
+	HTTPMethodKind = "http"
+	// TopicMethodKind is the kind of message broker topics.
+	// Service is the broker ( kafka or pubsub ) and Name is the topic.
+	TopicMethodKind = "topic"
+	// TableMethodKind is the kind of database tables.
+	// Name is the table and Access is the read or write intent.
+	TableMethodKind = "table"
+	// ConsumerMethodKind is the kind of functions consuming messages from topics.
+	// Service is the name of the service and Name is the function subscribing the topics.
+	ConsumerMethodKind = "consumer"
+	// GatewayMethodKind is the kind of routes registered by grpc-gateway.
+	// Service is the name of the service and Name is the route like "GET UserService/GetUser".
+	GatewayMethodKind = "gateway"
+	// UnknownMethodKind is the kind of RPCs invoked dynamically which can't be mapped to the method parsed from proto.
+	// Service is "unknown" and Name is the method like "/pkg.Service/Method" ( unresolved parts are "*" ).
+	UnknownMethodKind = "unknown"
+	// CallerMethodKind is the kind of functions calling other services without serving any RPCs like main of batch jobs.
+	// Service is the name of the service and Name is the function relative to the repository like "cmd/cleanup.main".
+	CallerMethodKind = "caller"
+	// HTTPHandlerMethodKind is the kind of HTTP handlers.
+	// Service is the name of the service and Name is the route like "GET /v1/users".
+	HTTPHandlerMethodKind = "http_handler"
+)
+
 type Method struct {
+	Kind          string `yaml:"kind,omitempty"`
 	Pkg           string `yaml:"pkg"`
 	GeneratedPath string `yaml:"generated_path"`
 	Service       string `yaml:"service"`
 	Name          string `yaml:"name"`
 	InputType     string `yaml:"input_type"`
 	OutputType    string `yaml:"output_type"`
+	// ProtoService is the name of the service declared in proto file.
+	ProtoService string `yaml:"proto_service,omitempty"`
+	// Access is the read or write intent for tables ( read, write or read/write ).
+	Access string `yaml:"access,omitempty"`
+}
+
+// ProtoServiceFullName returns the name of the service qualified by the proto package like "pkg.Service".
+func (m *Method) ProtoServiceFullName() string {
+	if m.Pkg == "" {
+		return m.ProtoService
+	}
+	return fmt.Sprintf("%s.%s", m.Pkg, m.ProtoService)
+}
+
+func (m *Method) IsGRPC() bool {
+	return m.Kind == GRPCMethodKind
+}
+
+// IsExternal reports whether the method is provided by other than analyzed services.
+func (m *Method) IsExternal() bool {
+	return m.Kind == HTTPMethodKind || m.Kind == TopicMethodKind || m.Kind == TableMethodKind || m.Kind == UnknownMethodKind
+}
+
+// DisplayName returns the name to identify the method in graphs and commands.
+func (m *Method) DisplayName() string {
+	if m.IsExternal() {
+		return fmt.Sprintf("%s %s", m.Service, m.Name)
+	}
+	return fmt.Sprintf("%s.%s", m.Service, m.Name)
 }
 
 func (m *Method) GeneratedPathToRepo() string {
 	// GeneratedPath starts with like github.com/org/repo/a/b/c...
 	paths := strings.Split(m.GeneratedPath, "/")
+	if len(paths) < 3 {
+		return m.GeneratedPath
+	}
 	return strings.Join(paths[:3], "/")
 }
 
 func (m *Method) MangledName() string {
+	if !m.IsGRPC() {
+		return strings.ToLower(fmt.Sprintf("%s:%s.%s", m.Kind, m.Service, m.Name))
+	}
 	return strings.ToLower(fmt.Sprintf("%s.%s.%s.%s", m.Service, m.Name, m.InputType, m.OutputType))
 }
 
+// LoadConfig loads the config specified by opt. If opt doesn't specify the config path, the config has no services.
 func LoadConfig(opt *Option) (*Config, error) {
-	file, err := ioutil.ReadFile(opt.Config)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to load config: %w", err)
-	}
 	var cfg Config
-	if err := yaml.Unmarshal(file, &cfg); err != nil {
-		return nil, xerrors.Errorf("failed to unmarshal: %w", err)
+	if opt.Config != "" {
+		file, err := ioutil.ReadFile(opt.Config)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to load config: %w", err)
+		}
+		if err := yaml.Unmarshal(file, &cfg); err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal: %w", err)
+		}
 	}
 	cfg.Output = opt.Output
+	cfg.Formats = opt.Format
+	if len(cfg.Formats) == 0 {
+		cfg.Formats = []string{HTMLFormat}
+	}
+	cfg.Timeout = opt.Timeout
+	cfg.Progress = opt.Progress
+	cfg.Isolate = opt.Isolate
+	if opt.MemoryLimit != "" {
+		limit, err := parseBytes(opt.MemoryLimit)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid memory limit: %w", err)
+		}
+		cfg.MemoryLimit = limit
+	}
+	for _, service := range cfg.Services {
+		if _, err := service.AnalysisTimeout(cfg.Timeout); err != nil {
+			return nil, xerrors.Errorf("invalid timeout of %s: %w", service.Name, err)
+		}
+		if _, err := service.AnalysisMemoryLimit(cfg.MemoryLimit); err != nil {
+			return nil, xerrors.Errorf("invalid memory limit of %s: %w", service.Name, err)
+		}
+	}
 	return &cfg, nil
 }
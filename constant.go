@@ -0,0 +1,260 @@
+package servicetracer
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	// unresolvedPart replaces the part of string which cannot be resolved statically.
+	unresolvedPart = "*"
+
+	maxResolveDepth = 16
+)
+
+var (
+	formatVerbPattern = regexp.MustCompile(`%[-+# 0]*[0-9*]*(\.[0-9*]+)?[a-zA-Z]`)
+)
+
+// resolveString resolves v into a string by following constants, string concatenations,
+// fmt.Sprintf with constant format and package level variables initialized by constants.
+// Values read from environment variables or viper config are resolved into the key like "${ORDER_TOPIC}".
+// Parts which cannot be resolved are replaced by "*", and the second result reports whether v is resolved completely.
+func resolveString(v ssa.Value) (string, bool) {
+	return resolveStringWithDepth(v, 0)
+}
+
+func resolveStringWithDepth(v ssa.Value, depth int) (string, bool) {
+	if v == nil || depth > maxResolveDepth {
+		return unresolvedPart, false
+	}
+	switch value := v.(type) {
+	case *ssa.Const:
+		if value.Value == nil || value.Value.Kind() != constant.String {
+			return unresolvedPart, false
+		}
+		return constant.StringVal(value.Value), true
+	case *ssa.ChangeType:
+		return resolveStringWithDepth(value.X, depth+1)
+	case *ssa.MakeInterface:
+		return resolveStringWithDepth(value.X, depth+1)
+	case *ssa.BinOp:
+		if value.Op != token.ADD {
+			return unresolvedPart, false
+		}
+		x, xok := resolveStringWithDepth(value.X, depth+1)
+		y, yok := resolveStringWithDepth(value.Y, depth+1)
+		return x + y, xok && yok
+	case *ssa.Phi:
+		var (
+			resolved string
+			ok       = true
+		)
+		for idx, edge := range value.Edges {
+			s, exact := resolveStringWithDepth(edge, depth+1)
+			if idx == 0 {
+				resolved = s
+			} else if resolved != s {
+				return unresolvedPart, false
+			}
+			ok = ok && exact
+		}
+		return resolved, ok
+	case *ssa.UnOp:
+		if value.Op != token.MUL {
+			return unresolvedPart, false
+		}
+		if global, ok := value.X.(*ssa.Global); ok {
+			return resolveGlobalString(global, depth+1)
+		}
+	case *ssa.Call:
+		if key, ok := resolveConfigKey(value.Common(), depth+1); ok {
+			return key, false
+		}
+		return resolveSprintf(value.Common(), depth+1)
+	case *ssa.Extract:
+		if call, ok := value.Tuple.(*ssa.Call); ok && value.Index == 0 {
+			if key, ok := resolveConfigKey(call.Common(), depth+1); ok {
+				return key, false
+			}
+		}
+	}
+	return unresolvedPart, false
+}
+
+// resolveConfigKey resolves the key of os.Getenv, os.LookupEnv and viper.GetString into "${KEY}".
+func resolveConfigKey(call *ssa.CallCommon, depth int) (string, bool) {
+	fn := call.StaticCallee()
+	if fn == nil || fn.Pkg == nil {
+		return "", false
+	}
+	args := call.Args
+	switch fn.Pkg.Pkg.Path() {
+	case "os":
+		if fn.Name() != "Getenv" && fn.Name() != "LookupEnv" {
+			return "", false
+		}
+	case "github.com/spf13/viper":
+		if fn.Name() != "GetString" {
+			return "", false
+		}
+		if fn.Signature.Recv() != nil {
+			args = args[1:]
+		}
+	default:
+		return "", false
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	key, ok := resolveStringWithDepth(args[0], depth)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("${%s}", key), true
+}
+
+// resolveFieldString resolves the string field of the struct built by composite literal.
+// v is the pointer to the struct ( &T{Field: "value"} ) or the struct value ( T{Field: "value"} ).
+func resolveFieldString(v ssa.Value, field string) (string, bool) {
+	if load, ok := v.(*ssa.UnOp); ok && load.Op == token.MUL {
+		v = load.X
+	}
+	alloc, ok := v.(*ssa.Alloc)
+	if !ok || alloc.Referrers() == nil {
+		return unresolvedPart, false
+	}
+	ptr, ok := alloc.Type().Underlying().(*types.Pointer)
+	if !ok {
+		return unresolvedPart, false
+	}
+	st, ok := ptr.Elem().Underlying().(*types.Struct)
+	if !ok {
+		return unresolvedPart, false
+	}
+	for _, ref := range *alloc.Referrers() {
+		fieldAddr, ok := ref.(*ssa.FieldAddr)
+		if !ok || st.Field(fieldAddr.Field).Name() != field || fieldAddr.Referrers() == nil {
+			continue
+		}
+		for _, fieldRef := range *fieldAddr.Referrers() {
+			if store, ok := fieldRef.(*ssa.Store); ok && store.Addr == fieldAddr {
+				return resolveString(store.Val)
+			}
+		}
+	}
+	return unresolvedPart, false
+}
+
+// resolveStrings resolves the string slice built by composite literal ( []string{"a", "b"} ).
+func resolveStrings(v ssa.Value) []string {
+	slice, ok := v.(*ssa.Slice)
+	if !ok {
+		s, _ := resolveString(v)
+		return []string{s}
+	}
+	alloc, ok := slice.X.(*ssa.Alloc)
+	if !ok || alloc.Referrers() == nil {
+		return []string{unresolvedPart}
+	}
+	values := []string{}
+	for _, ref := range *alloc.Referrers() {
+		indexAddr, ok := ref.(*ssa.IndexAddr)
+		if !ok || indexAddr.Referrers() == nil {
+			continue
+		}
+		for _, indexRef := range *indexAddr.Referrers() {
+			if store, ok := indexRef.(*ssa.Store); ok && store.Addr == indexAddr {
+				s, _ := resolveString(store.Val)
+				values = append(values, s)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return []string{unresolvedPart}
+	}
+	return values
+}
+
+// producerCall returns the static call which produced v ( including the first result of multiple results ).
+func producerCall(v ssa.Value) *ssa.CallCommon {
+	switch value := v.(type) {
+	case *ssa.Call:
+		return value.Common()
+	case *ssa.Extract:
+		if call, ok := value.Tuple.(*ssa.Call); ok && value.Index == 0 {
+			return call.Common()
+		}
+	}
+	return nil
+}
+
+// resolveGlobalString resolves the package level variable assigned only once in the package initializer.
+func resolveGlobalString(global *ssa.Global, depth int) (string, bool) {
+	if global.Pkg == nil {
+		return unresolvedPart, false
+	}
+	init := global.Pkg.Func("init")
+	if init == nil {
+		return unresolvedPart, false
+	}
+	var stored []ssa.Value
+	for _, block := range init.Blocks {
+		for _, instr := range block.Instrs {
+			store, ok := instr.(*ssa.Store)
+			if !ok || store.Addr != global {
+				continue
+			}
+			stored = append(stored, store.Val)
+		}
+	}
+	if len(stored) != 1 {
+		return unresolvedPart, false
+	}
+	return resolveStringWithDepth(stored[0], depth)
+}
+
+func resolveSprintf(call *ssa.CallCommon, depth int) (string, bool) {
+	fn := call.StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != "fmt" || fn.Name() != "Sprintf" {
+		return unresolvedPart, false
+	}
+	if len(call.Args) == 0 {
+		return unresolvedPart, false
+	}
+	format, ok := resolveStringWithDepth(call.Args[0], depth)
+	if !ok {
+		return unresolvedPart, false
+	}
+	format = strings.Replace(format, "%%", "\x00", -1)
+	resolved := formatVerbPattern.ReplaceAllString(format, unresolvedPart)
+	return strings.Replace(resolved, "\x00", "%", -1), false
+}
+
+// callRecv returns the receiver of the method call.
+func callRecv(site ssa.CallInstruction) ssa.Value {
+	common := site.Common()
+	if common.IsInvoke() {
+		return common.Value
+	}
+	if len(common.Args) == 0 {
+		return nil
+	}
+	return common.Args[0]
+}
+
+// callArgs returns the arguments of the call excluding the receiver.
+func callArgs(site ssa.CallInstruction, callee *ssa.Function) []ssa.Value {
+	common := site.Common()
+	args := common.Args
+	if !common.IsInvoke() && callee.Signature.Recv() != nil && len(args) > 0 {
+		return args[1:]
+	}
+	return args
+}
@@ -0,0 +1,210 @@
+package servicetracer
+
+import (
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+var (
+	errorType = types.Universe.Lookup("error").Type()
+
+	// errorConstructors are the functions returning non-nil error whose bodies don't show it
+	// ( e.g. status.Error returns nil only for codes.OK, which isn't returned as the error ).
+	errorConstructors = map[string]struct{}{
+		"errors.New":                               {},
+		"fmt.Errorf":                               {},
+		"golang.org/x/xerrors.New":                 {},
+		"golang.org/x/xerrors.Errorf":              {},
+		"github.com/pkg/errors.New":                {},
+		"github.com/pkg/errors.Errorf":             {},
+		"google.golang.org/grpc/status.Error":      {},
+		"google.golang.org/grpc/status.Errorf":     {},
+		"google.golang.org/grpc/status.ErrorProto": {},
+	}
+
+	// asyncFuncs maps the package to the functions running the given function in a new goroutine.
+	asyncFuncs = map[string]map[string]struct{}{
+		"golang.org/x/sync/errgroup": {
+			"(*Group).Go": {}, "(*Group).TryGo": {},
+		},
+		"sync": {
+			"(*WaitGroup).Go": {},
+		},
+		"github.com/sourcegraph/conc": {
+			"(*WaitGroup).Go": {},
+		},
+		"github.com/sourcegraph/conc/pool": {
+			"(*Pool).Go": {}, "(*ErrorPool).Go": {}, "(*ContextPool).Go": {}, "(*ResultPool).Go": {},
+		},
+	}
+)
+
+// isConditionalCall reports whether the call is skipped on some paths of the caller succeeding.
+// The call is unconditional if its block dominates every block returning from the caller without error,
+// so the calls after the early returns like "if err != nil { return nil, err }" are still unconditional.
+func isConditionalCall(site ssa.CallInstruction) bool {
+	if site == nil || site.Block() == nil {
+		return false
+	}
+	block := site.Block()
+	for _, b := range block.Parent().Blocks {
+		if len(b.Instrs) == 0 {
+			continue
+		}
+		ret, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return)
+		if !ok || isErrorReturn(ret) {
+			continue
+		}
+		if !block.Dominates(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// isErrorReturn reports whether ret returns the non-nil error as the last result.
+// The error is non-nil if it's known to be non-nil ( e.g. created by errors.New ), or it's checked by "err != nil" on the way to ret.
+// The error returned by other calls may be nil, so "return nil, helper()" is the path of the caller succeeding.
+func isErrorReturn(ret *ssa.Return) bool {
+	if len(ret.Results) == 0 {
+		return false
+	}
+	v := ret.Results[len(ret.Results)-1]
+	if !types.Identical(v.Type(), errorType) {
+		return false
+	}
+	if c, ok := v.(*ssa.Const); ok {
+		return !c.IsNil()
+	}
+	if isNonNilError(v, 0) {
+		return true
+	}
+	return isNonNilChecked(ret.Block())
+}
+
+// isNonNilError reports whether the error value v is never nil.
+func isNonNilError(v ssa.Value, depth int) bool {
+	if depth > maxResolveDepth {
+		return false
+	}
+	switch value := v.(type) {
+	case *ssa.Const:
+		return !value.IsNil()
+	case *ssa.MakeInterface:
+		// the interface holding the concrete value isn't nil even if the value is the nil pointer.
+		return true
+	case *ssa.Call:
+		return returnsNonNilError(value.Common().StaticCallee(), depth+1)
+	case *ssa.Extract:
+		call, ok := value.Tuple.(*ssa.Call)
+		if !ok || value.Index != value.Tuple.Type().(*types.Tuple).Len()-1 {
+			return false
+		}
+		return returnsNonNilError(call.Common().StaticCallee(), depth+1)
+	}
+	return false
+}
+
+// returnsNonNilError reports whether every return of fn returns the non-nil error as the last result.
+func returnsNonNilError(fn *ssa.Function, depth int) bool {
+	if fn == nil {
+		return false
+	}
+	if _, exists := errorConstructors[fn.String()]; exists {
+		return true
+	}
+	returned := false
+	for _, block := range fn.Blocks {
+		if len(block.Instrs) == 0 {
+			continue
+		}
+		ret, ok := block.Instrs[len(block.Instrs)-1].(*ssa.Return)
+		if !ok {
+			continue
+		}
+		if len(ret.Results) == 0 || !isNonNilError(ret.Results[len(ret.Results)-1], depth) {
+			return false
+		}
+		returned = true
+	}
+	return returned
+}
+
+// isNonNilChecked reports whether block is reached only when some error is checked by "err != nil".
+func isNonNilChecked(block *ssa.BasicBlock) bool {
+	for d := block.Idom(); d != nil; d = d.Idom() {
+		if len(d.Instrs) == 0 || len(d.Succs) != 2 {
+			continue
+		}
+		ifInstr, ok := d.Instrs[len(d.Instrs)-1].(*ssa.If)
+		if !ok {
+			continue
+		}
+		cond, ok := ifInstr.Cond.(*ssa.BinOp)
+		if !ok || !isNilErrorComparison(cond) {
+			continue
+		}
+		switch {
+		case cond.Op == token.NEQ && d.Succs[0].Dominates(block):
+			return true
+		case cond.Op == token.EQL && d.Succs[1].Dominates(block):
+			return true
+		}
+	}
+	return false
+}
+
+func isNilErrorComparison(cond *ssa.BinOp) bool {
+	if cond.Op != token.NEQ && cond.Op != token.EQL {
+		return false
+	}
+	x, y := cond.X, cond.Y
+	if c, ok := x.(*ssa.Const); ok && c.IsNil() {
+		x, y = y, x
+	}
+	c, ok := y.(*ssa.Const)
+	return ok && c.IsNil() && types.Identical(x.Type(), errorType)
+}
+
+// isCallInLoop reports whether the block of the call is a part of the cycle in the control flow graph of the caller.
+func isCallInLoop(site ssa.CallInstruction) bool {
+	if site == nil || site.Block() == nil {
+		return false
+	}
+	block := site.Block()
+	visited := map[*ssa.BasicBlock]struct{}{}
+	stack := append([]*ssa.BasicBlock{}, block.Succs...)
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if b == block {
+			return true
+		}
+		if _, exists := visited[b]; exists {
+			continue
+		}
+		visited[b] = struct{}{}
+		stack = append(stack, b.Succs...)
+	}
+	return false
+}
+
+// isAsyncCall reports whether the call spawns a goroutine.
+// Passing the function to errgroup.Group.Go and so on is also async,
+// so the dependency is async even if the traversal doesn't follow the goroutine spawned inside of the package.
+func isAsyncCall(site ssa.CallInstruction) bool {
+	if site == nil {
+		return false
+	}
+	if _, ok := site.(*ssa.Go); ok {
+		return true
+	}
+	callee := site.Common().StaticCallee()
+	if callee == nil || callee.Pkg == nil {
+		return false
+	}
+	_, exists := asyncFuncs[callee.Pkg.Pkg.Path()][relFuncName(callee)]
+	return exists
+}
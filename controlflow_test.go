@@ -0,0 +1,179 @@
+package servicetracer
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+const controlFlowFixture = `package main
+
+import (
+	"errors"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type notFoundError struct{}
+
+func (e *notFoundError) Error() string { return "not found" }
+
+func target() error { return nil }
+
+func validate() error { return nil }
+
+func failed() error { return errors.New("failed") }
+
+func always() error {
+	target()
+	return nil
+}
+
+func afterEarlyReturn(err error) error {
+	if err != nil {
+		return err
+	}
+	target()
+	return nil
+}
+
+func afterErrorCheck() error {
+	if err := validate(); err != nil {
+		return validate()
+	}
+	target()
+	return nil
+}
+
+func inBranch(c bool) error {
+	if c {
+		target()
+	}
+	return nil
+}
+
+func afterHelperReturn(c bool) error {
+	if c {
+		return validate()
+	}
+	target()
+	return nil
+}
+
+func afterConstructorReturn(c bool) error {
+	if c {
+		return failed()
+	}
+	target()
+	return nil
+}
+
+func afterTypedReturn(c bool) error {
+	if c {
+		return &notFoundError{}
+	}
+	target()
+	return nil
+}
+
+func afterSwallowedError(err error) error {
+	if err != nil {
+		return nil
+	}
+	target()
+	return nil
+}
+
+func inLoop(n int) {
+	for i := 0; i < n; i++ {
+		target()
+	}
+}
+
+func inRange(ids []string) {
+	for range ids {
+		target()
+	}
+}
+
+func afterLoop(n int) {
+	for i := 0; i < n; i++ {
+	}
+	target()
+}
+
+func inGoroutine() {
+	go target()
+}
+
+func inErrgroup() error {
+	var eg errgroup.Group
+	eg.Go(target)
+	return eg.Wait()
+}
+
+func main() {}
+`
+
+// callSite returns the first call in fn to the function named callee.
+func callSite(t *testing.T, fn *ssa.Function, callee string) ssa.CallInstruction {
+	t.Helper()
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok || call.Common().StaticCallee() == nil {
+				continue
+			}
+			if call.Common().StaticCallee().Name() == callee {
+				return call
+			}
+		}
+	}
+	t.Fatalf("%s doesn't call %s", fn, callee)
+	return nil
+}
+
+func TestControlFlow(t *testing.T) {
+	mainPkgs := buildFixture(t, map[string]string{
+		fixtureRepo + "/cmd/job": controlFlowFixture,
+	})
+	tests := []struct {
+		fn          string
+		callee      string
+		conditional bool
+		inLoop      bool
+		async       bool
+	}{
+		{fn: "always", callee: "target"},
+		{fn: "afterEarlyReturn", callee: "target"},
+		{fn: "afterErrorCheck", callee: "target"},
+		{fn: "inBranch", callee: "target", conditional: true},
+		{fn: "afterHelperReturn", callee: "target", conditional: true},
+		{fn: "afterConstructorReturn", callee: "target"},
+		{fn: "afterTypedReturn", callee: "target"},
+		{fn: "afterSwallowedError", callee: "target", conditional: true},
+		{fn: "inLoop", callee: "target", conditional: true, inLoop: true},
+		{fn: "inRange", callee: "target", conditional: true, inLoop: true},
+		{fn: "afterLoop", callee: "target"},
+		{fn: "inGoroutine", callee: "target", async: true},
+		{fn: "inErrgroup", callee: "Go", async: true},
+	}
+	for _, test := range tests {
+		t.Run(test.fn, func(t *testing.T) {
+			fn := mainPkgs[0].Func(test.fn)
+			if fn == nil {
+				t.Fatalf("%s is not in the fixture", test.fn)
+			}
+			site := callSite(t, fn, test.callee)
+			if conditional := isConditionalCall(site); conditional != test.conditional {
+				t.Errorf("expected conditional %t but got %t", test.conditional, conditional)
+			}
+			if inLoop := isCallInLoop(site); inLoop != test.inLoop {
+				t.Errorf("expected in-loop %t but got %t", test.inLoop, inLoop)
+			}
+			if async := isAsyncCall(site); async != test.async {
+				t.Errorf("expected async %t but got %t", test.async, async)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package servicetracer
+
+import (
+	"go/types"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/xerrors"
+)
+
+// Detector decides whether the callee of the call graph edge is an outbound dependency.
+// Detect returns the targets of the dependency ( e.g. a SQL query may access several tables ),
+// or nil if the callee isn't a dependency.
+type Detector interface {
+	Name() string
+	Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error)
+}
+
+// EntryDetector finds entry points other than gRPC handlers ( e.g. message consumers ).
+// DetectEntry is consulted for each edge of the call graph, and returns nil if the edge doesn't register entry points.
+// Outbound dependencies of the entry point are detected by traversing the call graph from Entry.Roots.
+type EntryDetector interface {
+	Name() string
+	DetectEntry(ctx *DetectContext, edge *callgraph.Edge) ([]*Entry, error)
+}
+
+type Entry struct {
+	// Method identifies the entry point. Service must be the name of analyzed service.
+	Method *Method
+	// Roots are the nodes where the traversal starts.
+	Roots []*callgraph.Node
+	// Subscriptions are the topics consumed by the entry point.
+	Subscriptions []*Method
+}
+
+// DetectContext is passed to Detector while traversing the call graph from the handler.
+type DetectContext struct {
+	Config    *Config
+	Service   *Service
+	CallGraph *callgraph.Graph
+	// Method is the handler where the traversal starts. It is nil while detecting entry points.
+	Method *Method
+	// Path is the call chain from the handler to the caller of the edge being detected.
+	Path []*callgraph.Edge
+}
+
+// GRPCDetector detects calls to the client stubs generated by protoc-gen-go-grpc, Twirp and connect-go.
+type GRPCDetector struct{}
+
+func (d *GRPCDetector) Name() string {
+	return "grpc"
+}
+
+func (d *GRPCDetector) Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	protoGoRepos, err := d.protoGoRepos(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get repositories of generated code: %w", err)
+	}
+	var found bool
+	for _, protoGoRepo := range protoGoRepos {
+		if d.isGRPCMethod(edge.Callee, protoGoRepo) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	mtd, err := d.ssaFuncToMethod(ctx.Config, edge.Callee.Func)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to convert ssa.Function to Method: %w", err)
+	}
+	return []*Method{mtd}, nil
+}
+
+// protoGoRepos returns the repositories of generated code that client stubs belong to.
+// For gRPC handlers, it's the repository of the handler's generated code.
+// Otherwise, all repositories of the configured services are candidates.
+func (d *GRPCDetector) protoGoRepos(ctx *DetectContext) ([]string, error) {
+	if ctx.Method != nil && ctx.Method.IsGRPC() {
+		return []string{ctx.Method.GeneratedPathToRepo()}, nil
+	}
+	repoMap := map[string]struct{}{}
+	repos := []string{}
+	for _, service := range ctx.Config.Services {
+		mtds, err := service.Methods()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			repo := mtd.GeneratedPathToRepo()
+			if repo == "" {
+				continue
+			}
+			if _, exists := repoMap[repo]; exists {
+				continue
+			}
+			repoMap[repo] = struct{}{}
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+func (d *GRPCDetector) removePkgPath(typ string) string {
+	splitted := strings.Split(typ, ".")
+	return splitted[len(splitted)-1]
+}
+
+func (d *GRPCDetector) ssaFuncToMethod(cfg *Config, fn *ssa.Function) (*Method, error) {
+	reqType, respType, _ := rpcMessageTypes(fn.Signature)
+
+	// the stub is resolved by its own package first, because the other packages may use the same messages.
+	// connect-go clients are generated into the other package than messages, so the package of messages is used next.
+	generatedPath := fn.Pkg.Pkg.Path()
+	service, err := cfg.serviceByGeneratedPath(generatedPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get service by generated path: %w", err)
+	}
+	if service == nil {
+		messagePath := messageTypePkgPath(reqType)
+		service, err = cfg.serviceByGeneratedPath(messagePath)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get service by message path: %w", err)
+		}
+		if service != nil {
+			generatedPath = messagePath
+		}
+	}
+	serviceName := generatedPath
+	if service != nil {
+		serviceName = service.Name
+	}
+	return &Method{
+		GeneratedPath: generatedPath,
+		Service:       serviceName,
+		Name:          fn.Name(),
+		InputType:     d.removePkgPath(reqType),
+		OutputType:    d.removePkgPath(respType),
+	}, nil
+}
+
+func (d *GRPCDetector) isGRPCMethod(node *callgraph.Node, protoGoRepo string) bool {
+	path := nodeToPkgPath(node)
+	if !strings.Contains(path, protoGoRepo) {
+		return false
+	}
+	if node.Func.Name() == "" || !unicode.IsUpper(rune(node.Func.Name()[0])) {
+		return false
+	}
+	reqType, respType, ok := rpcMessageTypes(node.Func.Signature)
+	if !ok {
+		return false
+	}
+	if !strings.Contains(messageTypePkgPath(reqType), protoGoRepo) {
+		return false
+	}
+	if !strings.Contains(messageTypePkgPath(respType), protoGoRepo) {
+		return false
+	}
+	return true
+}
+
+// relFuncName returns the name of fn relative to its package like "(*Client).Do".
+func relFuncName(fn *ssa.Function) string {
+	if fn.Pkg == nil {
+		return fn.String()
+	}
+	return fn.RelString(fn.Pkg.Pkg)
+}
+
+func nodeToPkgPath(node *callgraph.Node) string {
+	if node == nil {
+		return ""
+	}
+	if node.Func == nil {
+		return ""
+	}
+	if node.Func.Pkg == nil {
+		return ""
+	}
+	return node.Func.Pkg.Pkg.Path()
+}
+
+// declaredFunc returns the method wrapped by the synthetic function like the bound method value s.handle ( $bound ) or
+// the method expression (*T).handle ( $thunk ), because the call graph doesn't have synthetic nodes.
+// Otherwise, it returns fn itself.
+func declaredFunc(fn *ssa.Function) *ssa.Function {
+	if fn.Synthetic == "" {
+		return fn
+	}
+	obj, ok := fn.Object().(*types.Func)
+	if !ok {
+		return fn
+	}
+	if declared := fn.Prog.FuncValue(obj); declared != nil {
+		return declared
+	}
+	return fn
+}
+
+// funcNodes returns the call graph nodes of the function value like the callback of Receive.
+func funcNodes(cg *callgraph.Graph, v ssa.Value) []*callgraph.Node {
+	var fn *ssa.Function
+	switch value := v.(type) {
+	case *ssa.Function:
+		fn = declaredFunc(value)
+	case *ssa.MakeClosure:
+		// the method value like s.handle is the closure of the bound method wrapper.
+		if closure, ok := value.Fn.(*ssa.Function); ok {
+			fn = declaredFunc(closure)
+		}
+	case *ssa.ChangeType:
+		// http.HandlerFunc(f)
+		return funcNodes(cg, value.X)
+	case *ssa.MakeInterface:
+		return funcNodes(cg, value.X)
+	}
+	if fn == nil {
+		return nil
+	}
+	if node, exists := cg.Nodes[fn]; exists {
+		return []*callgraph.Node{node}
+	}
+	return nil
+}
+
+// methodNodes returns the call graph nodes of the method of the interface value like ConsumerGroupHandler.ConsumeClaim.
+func methodNodes(cg *callgraph.Graph, v ssa.Value, name string) []*callgraph.Node {
+	mi, ok := v.(*ssa.MakeInterface)
+	if !ok {
+		return nil
+	}
+	prog := mi.Parent().Prog
+	mset := prog.MethodSets.MethodSet(mi.X.Type())
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		if sel.Obj().Name() != name {
+			continue
+		}
+		if node, exists := cg.Nodes[prog.MethodValue(sel)]; exists {
+			return []*callgraph.Node{node}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package servicetracer
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/callgraph"
+)
+
+// cacheDetector detects the reads of the fixture cache as the custom dependency.
+type cacheDetector struct {
+	entries int
+}
+
+func (d *cacheDetector) Name() string {
+	return "cache"
+}
+
+func (d *cacheDetector) Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	if relFuncName(edge.Callee.Func) != "(*Client).Get" || nodeToPkgPath(edge.Callee) != fixtureRepo+"/cache" {
+		return nil, nil
+	}
+	key, _ := resolveString(callArgs(edge.Site, edge.Callee.Func)[0])
+	return []*Method{{Kind: "cache", Service: "redis", Name: key}}, nil
+}
+
+func (d *cacheDetector) DetectEntry(ctx *DetectContext, edge *callgraph.Edge) ([]*Entry, error) {
+	d.entries++
+	return nil, nil
+}
+
+const cacheFixture = `package cache
+
+type Client struct{}
+
+func (c *Client) Get(key string) string { return "" }
+`
+
+func TestRegisterDetector(t *testing.T) {
+	server := strings.Replace(orderServer, `name, err := s.userName(ctx, req.Id)`, `s.cache.Get("order:" + req.Id)
+	name, err := s.userName(ctx, req.Id)`, 1)
+	server = strings.Replace(server, `user user.UserServiceClient`, `user  user.UserServiceClient
+	cache *cache.Client`, 1)
+	server = strings.Replace(server, `&server{user: user.NewUserServiceClient(conn)}`, `&server{user: user.NewUserServiceClient(conn), cache: &cache.Client{}}`, 1)
+	server = strings.Replace(server, `"github.com/example/proto/order"`, `"github.com/example/proto/order"
+	"github.com/example/svc/cache"`, 1)
+	detector := &cacheDetector{}
+	methodMap := analyzeFixture(t, orderFixtureConfig(), map[string]string{
+		"github.com/example/proto/order": orderProto,
+		"github.com/example/proto/user":  userProto,
+		fixtureRepo + "/cache":           cacheFixture,
+		fixtureRepo + "/cmd/server":      server,
+	}, detector)
+	analyzedMethod := methodMap["order.getorder.getorderrequest.getorderresponse"]
+	if analyzedMethod == nil {
+		t.Fatal("GetOrder is not analyzed")
+	}
+	if diff := cmpStrings([]string{"redis.order:*", "user.GetUser"}, dependencyNames(analyzedMethod)); diff != "" {
+		t.Errorf("unexpected dependencies: %s", diff)
+	}
+	if detector.entries == 0 {
+		t.Error("the detector implementing EntryDetector isn't consulted for entries")
+	}
+}
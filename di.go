@@ -0,0 +1,204 @@
+package servicetracer
+
+import (
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+const (
+	fxPkgPath          = "go.uber.org/fx"
+	digPkgPath         = "go.uber.org/dig"
+	wireGeneratedFile  = "wire_gen.go"
+	fxAnnotateFuncName = "Annotate"
+)
+
+var (
+	// containerFuncs maps the package of DI containers to the functions taking constructors or invoked functions.
+	// The containers call them by reflection, so pointer analysis from main doesn't reach them.
+	containerFuncs = map[string]map[string]struct{}{
+		fxPkgPath: {
+			"Provide": {}, "Invoke": {}, "Decorate": {},
+		},
+		digPkgPath: {
+			"(*Container).Provide": {}, "(*Container).Invoke": {}, "(*Container).Decorate": {},
+			"(*Scope).Provide": {}, "(*Scope).Invoke": {}, "(*Scope).Decorate": {},
+		},
+	}
+)
+
+// analysisRoots returns the functions that main doesn't reach without reflection.
+// They are Service.AnalysisRoots, the functions given to fx or dig containers and Wire injectors nobody calls directly.
+// Only the repository of the service is scanned, because fx modules or Wire injectors of dependent modules
+// would switch the service not using DI to the less precise analysis.
+func (a *Analyzer) analysisRoots(service *Service, prog *ssa.Program) []*ssa.Function {
+	roots := []*ssa.Function{}
+	added := map[*ssa.Function]struct{}{}
+	add := func(fns ...*ssa.Function) {
+		for _, fn := range fns {
+			if _, exists := added[fn]; exists {
+				continue
+			}
+			added[fn] = struct{}{}
+			roots = append(roots, fn)
+		}
+	}
+	add(a.configuredRoots(service, prog)...)
+
+	called := map[*ssa.Function]struct{}{}
+	injectors := []*ssa.Function{}
+	for fn := range ssautil.AllFunctions(prog) {
+		if !inServiceRepo(service, fn) {
+			continue
+		}
+		if a.isWireInjector(prog, fn) {
+			injectors = append(injectors, fn)
+		}
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				call, ok := instr.(ssa.CallInstruction)
+				if !ok {
+					continue
+				}
+				callee := call.Common().StaticCallee()
+				if callee == nil {
+					continue
+				}
+				called[callee] = struct{}{}
+				if !a.isContainerFunc(callee) {
+					continue
+				}
+				for _, arg := range callArgs(call, callee) {
+					add(a.containerFuncValues(arg, 0)...)
+				}
+			}
+		}
+	}
+	for _, injector := range injectors {
+		if _, exists := called[injector]; !exists {
+			add(injector)
+		}
+	}
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].String() < roots[j].String()
+	})
+	return roots
+}
+
+// inServiceRepo reports whether fn is written in the repository of the service except for vendored packages.
+func inServiceRepo(service *Service, fn *ssa.Function) bool {
+	if !fn.Pos().IsValid() {
+		return false
+	}
+	file := fn.Prog.Fset.Position(fn.Pos()).Filename
+	rel := RelativePath(service, file)
+	return rel != file && !strings.HasPrefix(rel, "vendor/")
+}
+
+// configuredRoots resolves Service.AnalysisRoots into the functions.
+// The function is specified like "github.com/org/svc/server.NewServer",
+// and all methods of the type are specified like "*github.com/org/svc/server.Server".
+func (a *Analyzer) configuredRoots(service *Service, prog *ssa.Program) []*ssa.Function {
+	if len(service.AnalysisRoots) == 0 {
+		return nil
+	}
+	names := map[string]struct{}{}
+	for _, name := range service.AnalysisRoots {
+		names[name] = struct{}{}
+	}
+	roots := []*ssa.Function{}
+	for _, pkg := range prog.AllPackages() {
+		for _, member := range pkg.Members {
+			switch member := member.(type) {
+			case *ssa.Function:
+				if _, exists := names[member.String()]; exists {
+					roots = append(roots, member)
+				}
+			case *ssa.Type:
+				typ := member.Type()
+				for _, t := range []types.Type{typ, types.NewPointer(typ)} {
+					if _, exists := names[t.String()]; !exists {
+						continue
+					}
+					mset := prog.MethodSets.MethodSet(t)
+					for i := 0; i < mset.Len(); i++ {
+						if fn := prog.MethodValue(mset.At(i)); fn != nil {
+							roots = append(roots, fn)
+						}
+					}
+				}
+			}
+		}
+	}
+	return roots
+}
+
+func (a *Analyzer) isContainerFunc(fn *ssa.Function) bool {
+	if fn.Pkg == nil {
+		return false
+	}
+	funcs, exists := containerFuncs[fn.Pkg.Pkg.Path()]
+	if !exists {
+		return false
+	}
+	_, exists = funcs[relFuncName(fn)]
+	return exists
+}
+
+// isWireInjector reports whether fn is the injector generated by Wire.
+func (a *Analyzer) isWireInjector(prog *ssa.Program, fn *ssa.Function) bool {
+	if fn.Pkg == nil || fn.Parent() != nil || fn.Signature.Recv() != nil || !fn.Pos().IsValid() {
+		return false
+	}
+	return filepath.Base(prog.Fset.Position(fn.Pos()).Filename) == wireGeneratedFile
+}
+
+// containerFuncValues resolves the arguments of the DI container functions into the functions.
+// Variadic arguments like fx.Provide(NewServer, NewClient) and the constructors annotated by fx.Annotate are resolved.
+func (a *Analyzer) containerFuncValues(v ssa.Value, depth int) []*ssa.Function {
+	if depth > maxResolveDepth {
+		return nil
+	}
+	switch value := v.(type) {
+	case *ssa.Function:
+		return []*ssa.Function{value}
+	case *ssa.MakeClosure:
+		return a.containerFuncValues(value.Fn, depth+1)
+	case *ssa.MakeInterface:
+		return a.containerFuncValues(value.X, depth+1)
+	case *ssa.ChangeType:
+		return a.containerFuncValues(value.X, depth+1)
+	case *ssa.Slice:
+		alloc, ok := value.X.(*ssa.Alloc)
+		if !ok || alloc.Referrers() == nil {
+			return nil
+		}
+		funcs := []*ssa.Function{}
+		for _, ref := range *alloc.Referrers() {
+			indexAddr, ok := ref.(*ssa.IndexAddr)
+			if !ok || indexAddr.Referrers() == nil {
+				continue
+			}
+			for _, indexRef := range *indexAddr.Referrers() {
+				if store, ok := indexRef.(*ssa.Store); ok && store.Addr == indexAddr {
+					funcs = append(funcs, a.containerFuncValues(store.Val, depth+1)...)
+				}
+			}
+		}
+		return funcs
+	case *ssa.Call:
+		callee := value.Common().StaticCallee()
+		if callee == nil || callee.Pkg == nil || callee.Pkg.Pkg.Path() != fxPkgPath || callee.Name() != fxAnnotateFuncName {
+			return nil
+		}
+		if len(value.Common().Args) == 0 {
+			return nil
+		}
+		return a.containerFuncValues(value.Common().Args[0], depth+1)
+	}
+	return nil
+}
@@ -0,0 +1,470 @@
+package servicetracer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-graphviz/cgraph"
+	"golang.org/x/xerrors"
+)
+
+const (
+	systemDiagramName = "system"
+	// servicesDiagramDir separates the diagrams of the services from the system diagram,
+	// so the service named "system" doesn't overwrite it.
+	servicesDiagramDir = "services"
+)
+
+var (
+	unsafeFileNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	// diagramWriters maps the text formats to the writer of the diagram and the extension of the file.
+	diagramWriters = map[string]struct {
+		ext   string
+		write func(io.Writer, *diagram)
+	}{
+		DOTFormat:      {ext: "dot", write: writeDOT},
+		MermaidFormat:  {ext: "mmd", write: writeMermaid},
+		PlantUMLFormat: {ext: "puml", write: writePlantUML},
+	}
+)
+
+// diagram is the graph built from the method map independent of the output format.
+type diagram struct {
+	title    string
+	nodes    []*diagramNode
+	nodeMap  map[string]*diagramNode
+	edges    []*diagramEdge
+	edgeMap  map[string]struct{}
+	services []string
+}
+
+type diagramNode struct {
+	id    string
+	kind  string
+	label string
+	url   string
+	// service is the service clustering the node. It's empty for external targets.
+	service string
+}
+
+type diagramEdge struct {
+	from   *diagramNode
+	to     *diagramNode
+	styles []string
+	label  string
+}
+
+func newDiagram(title string) *diagram {
+	return &diagram{
+		title:   title,
+		nodeMap: map[string]*diagramNode{},
+		edgeMap: map[string]struct{}{},
+	}
+}
+
+func (d *diagram) node(mtd *Method, methodMap MethodMap) *diagramNode {
+	name := mtd.MangledName()
+	if node, exists := d.nodeMap[name]; exists {
+		return node
+	}
+	node := &diagramNode{
+		id:    fmt.Sprintf("n%d", len(d.nodes)+1),
+		kind:  mtd.Kind,
+		label: methodLabel(mtd),
+	}
+	if analyzedMethod, exists := methodMap[name]; exists {
+		node.url = analyzedMethod.SourceURL
+	}
+	if !mtd.IsExternal() {
+		node.service = mtd.Service
+		if !containsString(d.services, mtd.Service) {
+			d.services = append(d.services, mtd.Service)
+		}
+	}
+	d.nodes = append(d.nodes, node)
+	d.nodeMap[name] = node
+	return node
+}
+
+// edge adds the edge. It returns false if the edge already exists.
+func (d *diagram) edge(from, to *diagramNode, styles, labels []string) bool {
+	name := fmt.Sprintf("%s.%s", from.id, to.id)
+	if _, exists := d.edgeMap[name]; exists {
+		return false
+	}
+	d.edgeMap[name] = struct{}{}
+	d.edges = append(d.edges, &diagramEdge{
+		from:   from,
+		to:     to,
+		styles: styles,
+		label:  strings.Join(labels, ", "),
+	})
+	return true
+}
+
+// addDependencies adds the edges from mtd to its dependencies and from the published topics to the consumers.
+// If recursive is true, the dependencies of them are added too like the graph of the method in HTML,
+// and the dependencies to serviceName are skipped.
+func (d *diagram) addDependencies(serviceName string, mtd *Method, analyzedMethod *AnalyzedMethod, methodMap MethodMap, recursive bool) {
+	from := d.node(mtd, methodMap)
+	for _, dep := range analyzedMethod.Dependencies {
+		if recursive && dep.Method.Service == serviceName {
+			continue
+		}
+		if dep.Method.MangledName() == mtd.MangledName() {
+			continue
+		}
+		to := d.node(dep.Method, methodMap)
+		styles, labels := dependencyDecoration(dep)
+		if !d.edge(from, to, styles, labels) {
+			continue
+		}
+		if dep.Method.Kind == TopicMethodKind {
+			d.addSubscribers(serviceName, to, dep.Method, methodMap, recursive)
+		}
+		if toMethod, exists := methodMap[dep.Method.MangledName()]; exists && recursive {
+			d.addDependencies(serviceName, dep.Method, toMethod, methodMap, recursive)
+		}
+	}
+}
+
+func (d *diagram) addSubscribers(serviceName string, topicNode *diagramNode, topic *Method, methodMap MethodMap, recursive bool) {
+	for _, name := range sortedMethodNames(methodMap) {
+		consumer := methodMap[name]
+		if consumer.Entry == nil || !consumer.Subscribes(topic) {
+			continue
+		}
+		consumerNode := d.node(consumer.Entry, methodMap)
+		if !d.edge(topicNode, consumerNode, []string{string(cgraph.DottedEdgeStyle)}, []string{"subscribe"}) {
+			continue
+		}
+		if recursive {
+			d.addDependencies(serviceName, consumer.Entry, consumer, methodMap, recursive)
+		}
+	}
+}
+
+// methodDiagram builds the diagram of mtd same as the graph of the method in HTML.
+func (r *Renderer) methodDiagram(service *Service, mtd *Method, methodMap MethodMap) *diagram {
+	d := newDiagram(fmt.Sprintf("%s.%s", service.Name, mtd.Name))
+	d.node(mtd, methodMap)
+	if analyzedMethod, exists := methodMap[mtd.MangledName()]; exists {
+		d.addDependencies(service.Name, mtd, analyzedMethod, methodMap, true)
+	}
+	return d
+}
+
+// serviceDiagram builds the diagram of all methods of the services and their direct dependencies.
+func (r *Renderer) serviceDiagram(title string, services []*Service, methodMap MethodMap) (*diagram, error) {
+	d := newDiagram(title)
+	for _, service := range services {
+		mtds, err := r.serviceMethods(service, methodMap)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			d.node(mtd, methodMap)
+			if analyzedMethod, exists := methodMap[mtd.MangledName()]; exists {
+				d.addDependencies(service.Name, mtd, analyzedMethod, methodMap, false)
+			}
+		}
+	}
+	return d, nil
+}
+
+// serviceMethods returns the gRPC methods and the other entry points of the service.
+func (r *Renderer) serviceMethods(service *Service, methodMap MethodMap) ([]*Method, error) {
+	mtds, err := service.Methods()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse proto file: %w", err)
+	}
+	return append(append([]*Method{}, mtds...), r.entries(service, methodMap)...), nil
+}
+
+// renderDiagrams writes the diagrams in the text format to the directory named output.
+func (r *Renderer) renderDiagrams(format string, methodMap MethodMap) error {
+	writer, exists := diagramWriters[format]
+	if !exists {
+		return xerrors.Errorf("unknown diagram format %s", format)
+	}
+	return r.eachDiagram(methodMap, func(name string, d *diagram) error {
+		path := filepath.Join(r.cfg.Output, fmt.Sprintf("%s.%s", name, writer.ext))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return xerrors.Errorf("failed to create directory: %w", err)
+		}
+		var b strings.Builder
+		writer.write(&b, d)
+		if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+			return xerrors.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// eachDiagram calls fn with the diagrams and their names used as the path without the extension:
+// "system" for the whole system, "services/<service>" for each service
+// and "services/<service>/<ProtoService>.<method>" for each method.
+func (r *Renderer) eachDiagram(methodMap MethodMap, fn func(string, *diagram) error) error {
+	system, err := r.serviceDiagram(systemDiagramName, r.cfg.Services, methodMap)
+	if err != nil {
+		return xerrors.Errorf("failed to build system diagram: %w", err)
+	}
+	if err := fn(systemDiagramName, system); err != nil {
+		return xerrors.Errorf("failed to write system diagram: %w", err)
+	}
+	names := newDiagramNames()
+	for _, service := range r.cfg.Services {
+		d, err := r.serviceDiagram(service.Name, []*Service{service}, methodMap)
+		if err != nil {
+			return xerrors.Errorf("failed to build service diagram: %w", err)
+		}
+		serviceName := names.service(service)
+		if err := fn(serviceName, d); err != nil {
+			return xerrors.Errorf("failed to write service diagram: %w", err)
+		}
+		mtds, err := r.serviceMethods(service, methodMap)
+		if err != nil {
+			return xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			if err := fn(names.method(serviceName, mtd), r.methodDiagram(service, mtd, methodMap)); err != nil {
+				return xerrors.Errorf("failed to write method diagram: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// diagramNames assigns the unique names to the diagrams.
+// fileName maps different names to the same one ( e.g. "GET /a b" and "GET /a/b" ), and file systems may ignore the case,
+// so the colliding name has the hash of the original name as the suffix ( and the counter if it still collides ).
+// The names depend on the order of the calls, so the diagrams must be visited in the same order.
+type diagramNames struct {
+	used map[string]struct{}
+}
+
+func newDiagramNames() *diagramNames {
+	return &diagramNames{used: map[string]struct{}{}}
+}
+
+func (n *diagramNames) service(service *Service) string {
+	return n.unique(servicesDiagramDir, service.Name)
+}
+
+// method qualifies the gRPC method by the proto service,
+// because the service may implement several proto services having the same method name.
+func (n *diagramNames) method(serviceName string, mtd *Method) string {
+	name := mtd.Name
+	if mtd.ProtoService != "" {
+		name = fmt.Sprintf("%s.%s", mtd.ProtoService, mtd.Name)
+	}
+	return n.unique(serviceName, name)
+}
+
+func (n *diagramNames) unique(dir, name string) string {
+	base := fileName(name)
+	candidate := base
+	for i := 1; ; i++ {
+		key := strings.ToLower(path.Join(dir, candidate))
+		if _, exists := n.used[key]; !exists {
+			n.used[key] = struct{}{}
+			return path.Join(dir, candidate)
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(name))
+		candidate = fmt.Sprintf("%s-%08x", base, hash.Sum32())
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", candidate, i)
+		}
+	}
+}
+
+// fileName replaces the characters unsafe for file names ( e.g. "GET /v1/users" ) with "_".
+func fileName(name string) string {
+	return unsafeFileNamePattern.ReplaceAllString(name, "_")
+}
+
+// clusteredNodes returns the nodes grouped by the services in the order of appearance and the external nodes.
+func (d *diagram) clusteredNodes() (map[string][]*diagramNode, []*diagramNode) {
+	clusters := map[string][]*diagramNode{}
+	externals := []*diagramNode{}
+	for _, node := range d.nodes {
+		if node.service == "" {
+			externals = append(externals, node)
+			continue
+		}
+		clusters[node.service] = append(clusters[node.service], node)
+	}
+	return clusters, externals
+}
+
+func hasStyle(styles []string, style cgraph.EdgeStyle) bool {
+	return containsString(styles, string(style))
+}
+
+func writeDOT(w io.Writer, d *diagram) {
+	quote := func(s string) string {
+		s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+		return fmt.Sprintf(`"%s"`, s)
+	}
+	writeNode := func(indent string, node *diagramNode) {
+		attrs := []string{fmt.Sprintf("label=%s", quote(node.label))}
+		switch node.kind {
+		case HTTPMethodKind:
+			attrs = append(attrs, "shape=ellipse")
+		case TopicMethodKind:
+			attrs = append(attrs, "shape=cds")
+		case TableMethodKind:
+			attrs = append(attrs, "shape=cylinder")
+		case UnknownMethodKind:
+			attrs = append(attrs, "shape=octagon", "style=dashed")
+		}
+		if node.url != "" {
+			attrs = append(attrs, fmt.Sprintf("URL=%s", quote(node.url)))
+		}
+		fmt.Fprintf(w, "%s%s [%s];\n", indent, node.id, strings.Join(attrs, ", "))
+	}
+	fmt.Fprintf(w, "digraph %s {\n", quote(d.title))
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	clusters, externals := d.clusteredNodes()
+	for idx, service := range d.services {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", idx)
+		fmt.Fprintf(w, "    label=%s;\n", quote(service))
+		for _, node := range clusters[service] {
+			writeNode("    ", node)
+		}
+		fmt.Fprintln(w, "  }")
+	}
+	for _, node := range externals {
+		writeNode("  ", node)
+	}
+	for _, edge := range d.edges {
+		attrs := []string{}
+		if edge.label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%s", quote(edge.label)))
+		}
+		if len(edge.styles) != 0 {
+			attrs = append(attrs, fmt.Sprintf("style=%s", quote(strings.Join(edge.styles, ","))))
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(w, "  %s -> %s;\n", edge.from.id, edge.to.id)
+			continue
+		}
+		fmt.Fprintf(w, "  %s -> %s [%s];\n", edge.from.id, edge.to.id, strings.Join(attrs, ", "))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func writeMermaid(w io.Writer, d *diagram) {
+	quote := func(s string) string {
+		s = strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s)
+		return fmt.Sprintf(`"%s"`, s)
+	}
+	writeNode := func(indent string, node *diagramNode) {
+		label := quote(node.label)
+		switch node.kind {
+		case HTTPMethodKind:
+			fmt.Fprintf(w, "%s%s([%s])\n", indent, node.id, label)
+		case TopicMethodKind:
+			fmt.Fprintf(w, "%s%s>%s]\n", indent, node.id, label)
+		case TableMethodKind:
+			fmt.Fprintf(w, "%s%s[(%s)]\n", indent, node.id, label)
+		case UnknownMethodKind:
+			fmt.Fprintf(w, "%s%s{{%s}}\n", indent, node.id, label)
+		default:
+			fmt.Fprintf(w, "%s%s[%s]\n", indent, node.id, label)
+		}
+	}
+	fmt.Fprintln(w, "flowchart LR")
+	clusters, externals := d.clusteredNodes()
+	for idx, service := range d.services {
+		fmt.Fprintf(w, "  subgraph s%d [%s]\n", idx, quote(service))
+		for _, node := range clusters[service] {
+			writeNode("    ", node)
+		}
+		fmt.Fprintln(w, "  end")
+	}
+	for _, node := range externals {
+		writeNode("  ", node)
+	}
+	for _, edge := range d.edges {
+		arrow := "-->"
+		switch {
+		case hasStyle(edge.styles, cgraph.DashedEdgeStyle), hasStyle(edge.styles, cgraph.DottedEdgeStyle):
+			arrow = "-.->"
+		case hasStyle(edge.styles, cgraph.BoldEdgeStyle):
+			arrow = "==>"
+		}
+		if edge.label != "" {
+			arrow = fmt.Sprintf("%s|%s|", arrow, quote(edge.label))
+		}
+		fmt.Fprintf(w, "  %s %s %s\n", edge.from.id, arrow, edge.to.id)
+	}
+	for _, node := range d.nodes {
+		if node.url != "" {
+			fmt.Fprintf(w, "  click %s href %s\n", node.id, quote(node.url))
+		}
+	}
+}
+
+func writePlantUML(w io.Writer, d *diagram) {
+	quote := func(s string) string {
+		s = strings.NewReplacer(`"`, "'", "\n", `\n`).Replace(s)
+		return fmt.Sprintf(`"%s"`, s)
+	}
+	writeNode := func(indent string, node *diagramNode) {
+		element := "component"
+		switch node.kind {
+		case HTTPMethodKind:
+			element = "cloud"
+		case TopicMethodKind:
+			element = "queue"
+		case TableMethodKind:
+			element = "database"
+		}
+		line := fmt.Sprintf("%s%s %s as %s", indent, element, quote(node.label), node.id)
+		if node.kind == UnknownMethodKind {
+			line += " <<unknown>>"
+		}
+		if node.url != "" {
+			line += fmt.Sprintf(" [[%s]]", node.url)
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "@startuml %s\n", fileName(d.title))
+	fmt.Fprintln(w, "left to right direction")
+	clusters, externals := d.clusteredNodes()
+	for _, service := range d.services {
+		fmt.Fprintf(w, "rectangle %s {\n", quote(service))
+		for _, node := range clusters[service] {
+			writeNode("  ", node)
+		}
+		fmt.Fprintln(w, "}")
+	}
+	for _, node := range externals {
+		writeNode("", node)
+	}
+	for _, edge := range d.edges {
+		arrow := "-->"
+		switch {
+		case hasStyle(edge.styles, cgraph.DashedEdgeStyle), hasStyle(edge.styles, cgraph.DottedEdgeStyle):
+			arrow = "..>"
+		case hasStyle(edge.styles, cgraph.BoldEdgeStyle):
+			arrow = "-[bold]->"
+		}
+		if edge.label != "" {
+			fmt.Fprintf(w, "%s %s %s : %s\n", edge.from.id, arrow, edge.to.id, edge.label)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s %s\n", edge.from.id, arrow, edge.to.id)
+	}
+	fmt.Fprintln(w, "@enduml")
+}
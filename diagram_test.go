@@ -0,0 +1,90 @@
+package servicetracer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRenderDiagramsUniqueNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service-tracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the routes and the services differ only by the characters replaced in file names or by the case.
+	cfg := &Config{
+		Services: []*Service{fixtureService("order"), fixtureService("Order")},
+		Output:   filepath.Join(dir, "trace"),
+		Formats:  []string{MermaidFormat},
+	}
+	methodMap := MethodMap{}
+	for _, route := range []string{"GET /a b", "GET /a/b"} {
+		entry := &Method{Kind: HTTPHandlerMethodKind, Service: "order", Name: route}
+		methodMap[entry.MangledName()] = &AnalyzedMethod{Entry: entry}
+	}
+	r := NewRenderer(cfg)
+	names := []string{}
+	if err := r.eachDiagram(methodMap, func(name string, d *diagram) error {
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to visit diagrams: %+v", err)
+	}
+	used := map[string]string{}
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if other, exists := used[key]; exists {
+			t.Errorf("%s collides with %s", name, other)
+		}
+		used[key] = name
+	}
+	// the first one keeps the name, and the others have the suffix.
+	for _, name := range []string{"system", "services/order", "services/order/GET_a_b"} {
+		if used[strings.ToLower(name)] != name {
+			t.Errorf("%s is not rendered: %v", name, names)
+		}
+	}
+
+	if err := r.Render(methodMap); err != nil {
+		t.Fatalf("failed to render: %+v", err)
+	}
+	files := []string{}
+	if err := filepath.Walk(cfg.Output, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".mmd" {
+			return err
+		}
+		rel, err := filepath.Rel(cfg.Output, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, strings.TrimSuffix(filepath.ToSlash(rel), ".mmd"))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	sort.Strings(files)
+	if diff := cmpStrings(names, files); diff != "" {
+		t.Errorf("unexpected files: %s", diff)
+	}
+
+	// the index links the same files as written.
+	index, err := ioutil.ReadFile(filepath.Join(cfg.Output, indexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := []string{}
+	for _, match := range regexp.MustCompile(`href="([^"]+)\.mmd"`).FindAllStringSubmatch(string(index), -1) {
+		links = append(links, match[1])
+	}
+	sort.Strings(links)
+	if diff := cmpStrings(names, links); diff != "" {
+		t.Errorf("unexpected links: %s", diff)
+	}
+}
@@ -0,0 +1,266 @@
+package servicetracer
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+var (
+	gatewayRegisterPattern = regexp.MustCompile(`^Register(\w+)Handler(?:FromEndpoint|Client|Server)?$`)
+	gatewayRequestPattern  = regexp.MustCompile(`^(?:local_)?request_(\w+)_(\w+)_\d+$`)
+
+	// routeFuncs maps the package of HTTP routers to the functions registering the route.
+	// The value is the HTTP method of the route, or empty if the route accepts any methods.
+	routeFuncs = map[string]map[string]string{
+		httpPkgPath: {
+			"HandleFunc": "", "Handle": "",
+			"(*ServeMux).HandleFunc": "", "(*ServeMux).Handle": "",
+		},
+		"github.com/gorilla/mux": {
+			"(*Router).HandleFunc": "", "(*Router).Handle": "",
+		},
+		"github.com/go-chi/chi":    chiRouteFuncs,
+		"github.com/go-chi/chi/v5": chiRouteFuncs,
+	}
+	chiRouteFuncs = map[string]string{
+		"(*Mux).HandleFunc": "", "(*Mux).Handle": "",
+		"(*Mux).Get": http.MethodGet, "(*Mux).Head": http.MethodHead, "(*Mux).Post": http.MethodPost,
+		"(*Mux).Put": http.MethodPut, "(*Mux).Patch": http.MethodPatch, "(*Mux).Delete": http.MethodDelete,
+	}
+)
+
+// GatewayDetector finds the routes registered by grpc-gateway's Register*HandlerFromEndpoint, Register*HandlerClient and so on.
+// Each route is the entry point named by the HTTP method and the gRPC method like "GET UserService/GetUser".
+type GatewayDetector struct{}
+
+func (d *GatewayDetector) Name() string {
+	return "grpc-gateway"
+}
+
+func (d *GatewayDetector) DetectEntry(ctx *DetectContext, edge *callgraph.Edge) ([]*Entry, error) {
+	if edge.Site == nil || edge.Callee.Func.Pkg == nil || edge.Callee.Func.Signature.Recv() != nil {
+		return nil, nil
+	}
+	fn := edge.Callee.Func
+	if edge.Caller.Func.Pkg == fn.Pkg {
+		return nil, nil
+	}
+	matched := gatewayRegisterPattern.FindStringSubmatch(fn.Name())
+	if matched == nil || !d.isGatewayFunc(fn) {
+		return nil, nil
+	}
+	svc := matched[1]
+	entries := []*Entry{}
+	for _, suffix := range []string{"HandlerClient", "HandlerServer"} {
+		register := fn.Pkg.Func(fmt.Sprintf("Register%s%s", svc, suffix))
+		if register == nil {
+			continue
+		}
+		for _, route := range register.AnonFuncs {
+			node, exists := ctx.CallGraph.Nodes[route]
+			if !exists {
+				continue
+			}
+			name := d.routeName(route)
+			if name == "" {
+				continue
+			}
+			entries = append(entries, &Entry{
+				Method: &Method{
+					Kind:    GatewayMethodKind,
+					Service: ctx.Service.Name,
+					Name:    name,
+				},
+				Roots: []*callgraph.Node{node},
+			})
+		}
+	}
+	return entries, nil
+}
+
+// isGatewayFunc reports whether fn takes grpc-gateway's ServeMux.
+func (d *GatewayDetector) isGatewayFunc(fn *ssa.Function) bool {
+	params := fn.Signature.Params()
+	for i := 0; i < params.Len(); i++ {
+		if strings.Contains(params.At(i).Type().String(), "grpc-gateway") {
+			return true
+		}
+	}
+	return false
+}
+
+// routeName returns the name of the route like "GET UserService/GetUser".
+// The gRPC method is found from the generated request_<Service>_<Method>_<N> function called by the route,
+// and the HTTP method is found from the mux.Handle call registering the route.
+func (d *GatewayDetector) routeName(route *ssa.Function) string {
+	var rpc string
+	for _, block := range route.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+			callee := call.Common().StaticCallee()
+			if callee == nil {
+				continue
+			}
+			if matched := gatewayRequestPattern.FindStringSubmatch(callee.Name()); matched != nil {
+				rpc = fmt.Sprintf("%s/%s", matched[1], matched[2])
+			}
+		}
+	}
+	if rpc == "" {
+		return ""
+	}
+	method := unresolvedPart
+	for _, closure := range d.closures(route) {
+		if m, ok := d.handleMethod(closure); ok {
+			method = m
+		}
+	}
+	return fmt.Sprintf("%s %s", method, rpc)
+}
+
+// handleMethod resolves the HTTP method of the mux.Handle call registering the route.
+// The route is converted to runtime.HandlerFunc before the call.
+func (d *GatewayDetector) handleMethod(v ssa.Value) (string, bool) {
+	if v.Referrers() == nil {
+		return "", false
+	}
+	for _, ref := range *v.Referrers() {
+		switch instr := ref.(type) {
+		case *ssa.ChangeType:
+			if method, ok := d.handleMethod(instr); ok {
+				return method, true
+			}
+		case *ssa.Call:
+			callee := instr.Common().StaticCallee()
+			if callee == nil || callee.Name() != "Handle" {
+				continue
+			}
+			if args := callArgs(instr, callee); len(args) > 0 {
+				return resolveString(args[0])
+			}
+		}
+	}
+	return "", false
+}
+
+// closures returns the MakeClosure instructions of the anonymous function in the parent.
+func (d *GatewayDetector) closures(fn *ssa.Function) []*ssa.MakeClosure {
+	closures := []*ssa.MakeClosure{}
+	if fn.Parent() == nil {
+		return closures
+	}
+	for _, block := range fn.Parent().Blocks {
+		for _, instr := range block.Instrs {
+			if closure, ok := instr.(*ssa.MakeClosure); ok && closure.Fn == fn {
+				closures = append(closures, closure)
+			}
+		}
+	}
+	return closures
+}
+
+// HTTPHandlerDetector finds the HTTP handlers registered by net/http, gorilla/mux and chi with the constant path.
+// Each handler is the entry point named by the route like "GET /v1/users" ( or "/v1/users" if any methods are accepted ).
+type HTTPHandlerDetector struct{}
+
+func (d *HTTPHandlerDetector) Name() string {
+	return "http-handler"
+}
+
+func (d *HTTPHandlerDetector) DetectEntry(ctx *DetectContext, edge *callgraph.Edge) ([]*Entry, error) {
+	if edge.Site == nil {
+		return nil, nil
+	}
+	pkgPath := nodeToPkgPath(edge.Callee)
+	funcs, exists := routeFuncs[pkgPath]
+	if !exists || nodeToPkgPath(edge.Caller) == pkgPath {
+		return nil, nil
+	}
+	fn := edge.Callee.Func
+	method, exists := funcs[relFuncName(fn)]
+	if !exists {
+		return nil, nil
+	}
+	args := callArgs(edge.Site, fn)
+	if len(args) < 2 {
+		return nil, nil
+	}
+	path, ok := resolveString(args[0])
+	if !ok {
+		return nil, nil
+	}
+	roots := funcNodes(ctx.CallGraph, args[1])
+	if len(roots) == 0 {
+		roots = methodNodes(ctx.CallGraph, args[1], "ServeHTTP")
+	}
+	if len(roots) == 0 {
+		return nil, nil
+	}
+	name := path
+	if method != "" {
+		name = fmt.Sprintf("%s %s", method, path)
+	}
+	return []*Entry{{
+		Method: &Method{
+			Kind:    HTTPHandlerMethodKind,
+			Service: ctx.Service.Name,
+			Name:    name,
+		},
+		Roots: roots,
+	}}, nil
+}
+
+// CallerDetector finds the roots of caller-only services like batch jobs and CLI tools.
+// The roots are Service.Roots if configured, otherwise main functions of the service having no proto.
+type CallerDetector struct{}
+
+func (d *CallerDetector) Name() string {
+	return "caller"
+}
+
+func (d *CallerDetector) DetectEntry(ctx *DetectContext, edge *callgraph.Edge) ([]*Entry, error) {
+	fn := edge.Callee.Func
+	if fn.Pkg == nil || !d.isRoot(ctx, edge) {
+		return nil, nil
+	}
+	return []*Entry{{
+		Method: &Method{
+			Kind:    CallerMethodKind,
+			Service: ctx.Service.Name,
+			Name:    d.funcName(ctx.Service, fn),
+		},
+		Roots: []*callgraph.Node{edge.Callee},
+	}}, nil
+}
+
+func (d *CallerDetector) isRoot(ctx *DetectContext, edge *callgraph.Edge) bool {
+	fn := edge.Callee.Func
+	if len(ctx.Service.Roots) != 0 {
+		name := fn.String()
+		for _, root := range ctx.Service.Roots {
+			if root == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !ctx.Service.IsCallerOnly() || edge.Caller != ctx.CallGraph.Root {
+		return false
+	}
+	return fn.Pkg.Pkg.Name() == "main" && fn.Name() == "main"
+}
+
+// funcName returns the name of fn relative to the repository of service like "cmd/cleanup.main".
+func (d *CallerDetector) funcName(service *Service, fn *ssa.Function) string {
+	name := fn.String()
+	name = strings.Replace(name, service.Repo+"/", "", 1)
+	return strings.Replace(name, service.Repo+".", "", 1)
+}
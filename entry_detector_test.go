@@ -0,0 +1,258 @@
+package servicetracer
+
+import (
+	"testing"
+)
+
+const (
+	gatewayRuntime = `package runtime
+
+import (
+	"context"
+	"net/http"
+)
+
+type HandlerFunc func(w http.ResponseWriter, r *http.Request, pathParams map[string]string)
+
+type Pattern struct {
+	ops []int
+}
+
+func NewPattern(version int, ops []int, pool []string, verb string) (Pattern, error) {
+	return Pattern{ops: ops}, nil
+}
+
+func MustPattern(p Pattern, err error) Pattern { return p }
+
+type Marshaler interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type ServerMetadata struct{}
+
+type ServeMux struct {
+	handlers map[string][]HandlerFunc
+}
+
+func NewServeMux() *ServeMux { return &ServeMux{handlers: map[string][]HandlerFunc{}} }
+
+func (s *ServeMux) Handle(meth string, pat Pattern, h HandlerFunc) {
+	s.handlers[meth] = append(s.handlers[meth], h)
+}
+
+func (s *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, h := range s.handlers[r.Method] {
+		h(w, r, nil)
+	}
+}
+
+func ForwardResponseMessage(ctx context.Context, mux *ServeMux, w http.ResponseWriter, req *http.Request, resp interface{}) {}
+`
+	// gatewayOrderProto is the messages, the client stub and the handlers generated by protoc-gen-grpc-gateway.
+	gatewayOrderProto = `package order
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+type GetOrderRequest struct{ Id string }
+type GetOrderResponse struct{ UserName string }
+type CancelOrderRequest struct{ Id string }
+type CancelOrderResponse struct{}
+
+type OrderServiceClient interface {
+	GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*GetOrderResponse, error)
+	CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*CancelOrderResponse, error)
+}
+
+type orderServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrderServiceClient(cc grpc.ClientConnInterface) OrderServiceClient {
+	return &orderServiceClient{cc}
+}
+
+func (c *orderServiceClient) GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*GetOrderResponse, error) {
+	out := new(GetOrderResponse)
+	err := c.cc.Invoke(ctx, "/order.OrderService/GetOrder", in, out, opts...)
+	return out, err
+}
+
+func (c *orderServiceClient) CancelOrder(ctx context.Context, in *CancelOrderRequest, opts ...grpc.CallOption) (*CancelOrderResponse, error) {
+	out := new(CancelOrderResponse)
+	err := c.cc.Invoke(ctx, "/order.OrderService/CancelOrder", in, out, opts...)
+	return out, err
+}
+
+func request_OrderService_GetOrder_0(ctx context.Context, marshaler runtime.Marshaler, client OrderServiceClient, req *http.Request, pathParams map[string]string) (interface{}, runtime.ServerMetadata, error) {
+	var protoReq GetOrderRequest
+	var metadata runtime.ServerMetadata
+	protoReq.Id = pathParams["id"]
+	msg, err := client.GetOrder(ctx, &protoReq)
+	return msg, metadata, err
+}
+
+func request_OrderService_CancelOrder_0(ctx context.Context, marshaler runtime.Marshaler, client OrderServiceClient, req *http.Request, pathParams map[string]string) (interface{}, runtime.ServerMetadata, error) {
+	var protoReq CancelOrderRequest
+	var metadata runtime.ServerMetadata
+	protoReq.Id = pathParams["id"]
+	msg, err := client.CancelOrder(ctx, &protoReq)
+	return msg, metadata, err
+}
+
+func RegisterOrderServiceHandlerFromEndpoint(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) (err error) {
+	conn, err := grpc.Dial(endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	return RegisterOrderServiceHandler(ctx, mux, conn)
+}
+
+func RegisterOrderServiceHandler(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	return RegisterOrderServiceHandlerClient(ctx, mux, NewOrderServiceClient(conn))
+}
+
+func RegisterOrderServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux, client OrderServiceClient) error {
+	mux.Handle("GET", pattern_OrderService_GetOrder_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		var inboundMarshaler runtime.Marshaler
+		resp, _, err := request_OrderService_GetOrder_0(req.Context(), inboundMarshaler, client, req, pathParams)
+		if err != nil {
+			return
+		}
+		forward_OrderService_GetOrder_0(req.Context(), mux, w, req, resp)
+	})
+	mux.Handle("POST", pattern_OrderService_CancelOrder_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		var inboundMarshaler runtime.Marshaler
+		resp, _, err := request_OrderService_CancelOrder_0(req.Context(), inboundMarshaler, client, req, pathParams)
+		if err != nil {
+			return
+		}
+		forward_OrderService_CancelOrder_0(req.Context(), mux, w, req, resp)
+	})
+	return nil
+}
+
+var (
+	pattern_OrderService_GetOrder_0    = runtime.MustPattern(runtime.NewPattern(1, []int{2, 0, 2, 1, 1, 0}, []string{"v1", "orders", "id"}, ""))
+	pattern_OrderService_CancelOrder_0 = runtime.MustPattern(runtime.NewPattern(1, []int{2, 0, 2, 1, 1, 0}, []string{"v1", "orders", "id"}, "cancel"))
+	forward_OrderService_GetOrder_0    = runtime.ForwardResponseMessage
+	forward_OrderService_CancelOrder_0 = runtime.ForwardResponseMessage
+)
+`
+	// routes registers the handler named like the gateway, which isn't the entry point of grpc-gateway.
+	gatewayRoutes = `package routes
+
+import (
+	"net/http"
+)
+
+type health struct{}
+
+func (h *health) check(w http.ResponseWriter, r *http.Request) {
+	http.Get("https://db.example.com/ping")
+}
+
+func RegisterHealthHandler(mux *http.ServeMux) {
+	h := &health{}
+	mux.HandleFunc("/healthz", h.check)
+}
+`
+	gatewayServer = `package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/example/proto/order"
+	"github.com/example/svc/routes"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+type users struct{}
+
+func (u *users) list(w http.ResponseWriter, r *http.Request) {
+	http.Get("https://user.example.com/v1/users")
+}
+
+type admin struct{}
+
+func (a *admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.Get("https://admin.example.com/v1/audit")
+}
+
+func main() {
+	ctx := context.Background()
+	gw := runtime.NewServeMux()
+	order.RegisterOrderServiceHandlerFromEndpoint(ctx, gw, "localhost:9090", nil)
+
+	mux := http.NewServeMux()
+	routes.RegisterHealthHandler(mux)
+	u := &users{}
+	mux.Handle("/v1/users", http.HandlerFunc(u.list))
+	mux.Handle("/v1/admin", &admin{})
+	mux.Handle("/", gw)
+	http.ListenAndServe(":8080", mux)
+}
+`
+)
+
+func TestDetectEntries(t *testing.T) {
+	cfg := orderFixtureConfig()
+	cfg.Services[0].mtds = append(cfg.Services[0].mtds, &Method{
+		GeneratedPath: "github.com/example/proto/order",
+		Service:       "order",
+		Name:          "CancelOrder",
+		InputType:     "CancelOrderRequest",
+		OutputType:    "CancelOrderResponse",
+		ProtoService:  "OrderService",
+	})
+	fixture := map[string]string{
+		"github.com/grpc-ecosystem/grpc-gateway/v2/runtime": gatewayRuntime,
+		"github.com/example/proto/order":                    gatewayOrderProto,
+		fixtureRepo + "/routes":                             gatewayRoutes,
+		fixtureRepo + "/cmd/gateway":                        gatewayServer,
+	}
+	fixture["net/http"] = fixturePackages["net/http"] + `
+func (r *Request) Context() context.Context { return r.ctx }
+`
+	methodMap := analyzeFixture(t, cfg, fixture)
+	tests := []struct {
+		key          string
+		dependencies []string
+	}{
+		{key: "gateway:order.get orderservice/getorder", dependencies: []string{"order.GetOrder"}},
+		{key: "gateway:order.post orderservice/cancelorder", dependencies: []string{"order.CancelOrder"}},
+		{key: "http_handler:order./healthz", dependencies: []string{"db.example.com GET /ping"}},
+		{key: "http_handler:order./v1/users", dependencies: []string{"user.example.com GET /v1/users"}},
+		{key: "http_handler:order./v1/admin", dependencies: []string{"admin.example.com GET /v1/audit"}},
+		{key: "http_handler:order./", dependencies: []string{"order.CancelOrder", "order.GetOrder"}},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			analyzedMethod, exists := methodMap[test.key]
+			if !exists {
+				keys := []string{}
+				for key := range methodMap {
+					keys = append(keys, key)
+				}
+				t.Fatalf("%s is not detected: %v", test.key, keys)
+			}
+			if diff := cmpStrings(test.dependencies, dependencyNames(analyzedMethod)); diff != "" {
+				t.Errorf("unexpected dependencies: %s", diff)
+			}
+		})
+	}
+	// RegisterHealthHandler isn't grpc-gateway, and the client stubs don't serve the methods.
+	if len(methodMap) != len(tests) {
+		keys := []string{}
+		for key := range methodMap {
+			keys = append(keys, key)
+		}
+		t.Errorf("unexpected entries: %v", keys)
+	}
+}
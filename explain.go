@@ -0,0 +1,72 @@
+package servicetracer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Explain writes the call path that makes from ( e.g. serviceA.GetUser ) depend on to ( e.g. serviceB.GetProfile ).
+// to is the display name of the target like "api.example.com GET /v1/users" for the dependencies other than gRPC.
+func (t *ServiceTracer) Explain(w io.Writer, from, to string) error {
+	return t.ExplainContext(context.Background(), w, from, to)
+}
+
+// ExplainContext is Explain with ctx to cancel the analysis needed to explain.
+func (t *ServiceTracer) ExplainContext(ctx context.Context, w io.Writer, from, to string) error {
+	if name, output, ok := isolatedAnalysis(); ok {
+		return t.runIsolated(ctx, name, output)
+	}
+	methodMap, err := t.prepareMethodMap(ctx)
+	if err != nil {
+		return xerrors.Errorf("failed to prepare method map: %w", err)
+	}
+	mtd, err := t.findMethod(from, methodMap)
+	if err != nil {
+		return xerrors.Errorf("failed to find method: %w", err)
+	}
+	analyzedMethod, exists := methodMap[mtd.MangledName()]
+	if !exists {
+		return xerrors.Errorf("%s is not analyzed", from)
+	}
+	for _, dep := range analyzedMethod.Dependencies {
+		if dep.Method.DisplayName() != to {
+			continue
+		}
+		fmt.Fprintf(w, "%s -> %s (%s)\n", from, to, strings.Join(dep.Labels(), ", "))
+		for idx, site := range dep.Path {
+			fmt.Fprintf(w, "  %d. %s\n", idx+1, site.Caller)
+			if site.File != "" {
+				fmt.Fprintf(w, "       calls %s at %s:%d\n", site.Callee, site.File, site.Line)
+			} else {
+				fmt.Fprintf(w, "       calls %s\n", site.Callee)
+			}
+		}
+		return nil
+	}
+	return xerrors.Errorf("%s doesn't depend on %s", from, to)
+}
+
+// findMethod finds the gRPC method or the other entry point ( e.g. jobs.cmd/cleanup.main ) by name.
+func (t *ServiceTracer) findMethod(name string, methodMap MethodMap) (*Method, error) {
+	for _, service := range t.cfg.Services {
+		mtds, err := service.Methods()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			if fmt.Sprintf("%s.%s", service.Name, mtd.Name) == name {
+				return mtd, nil
+			}
+		}
+	}
+	for _, analyzedMethod := range methodMap {
+		if analyzedMethod.Entry != nil && analyzedMethod.Entry.DisplayName() == name {
+			return analyzedMethod.Entry, nil
+		}
+	}
+	return nil, xerrors.Errorf("unknown method %s", name)
+}
@@ -0,0 +1,256 @@
+package servicetracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// GraphSchemaVersion is the version of the schema of the JSON export.
+	// Change it when the schema changes incompatibly.
+	GraphSchemaVersion = 1
+	graphSchemaURL     = "https://raw.githubusercontent.com/goccy/go-service-tracer/master/schema/graph.schema.json"
+	subscribeEdgeKind  = "subscribe"
+	dependEdgeKind     = "depend"
+	grpcKindName       = "grpc"
+)
+
+// Graph is the whole dependency graph exported as JSON.
+// The schema is published at schema/graph.schema.json .
+type Graph struct {
+	Schema        string          `json:"$schema"`
+	SchemaVersion int             `json:"schema_version"`
+	Services      []*GraphService `json:"services"`
+	Externals     []*GraphMethod  `json:"externals"`
+	Edges         []*GraphEdge    `json:"edges"`
+}
+
+// GraphService is the service with its gRPC methods and the other entry points.
+type GraphService struct {
+	Name    string         `json:"name"`
+	Repo    string         `json:"repo,omitempty"`
+	Failure string         `json:"failure,omitempty"`
+	Methods []*GraphMethod `json:"methods"`
+}
+
+// GraphMethod is the node of the graph.
+// ID is unique in the graph and referred by the edges.
+type GraphMethod struct {
+	ID            string      `json:"id"`
+	Kind          string      `json:"kind"`
+	Service       string      `json:"service"`
+	Name          string      `json:"name"`
+	DisplayName   string      `json:"display_name"`
+	Proto         *GraphProto `json:"proto,omitempty"`
+	Access        string      `json:"access,omitempty"`
+	Analyzed      bool        `json:"analyzed"`
+	SourceURL     string      `json:"source_url,omitempty"`
+	Binaries      []string    `json:"binaries,omitempty"`
+	Subscriptions []string    `json:"subscriptions,omitempty"`
+}
+
+// GraphProto is the metadata of the gRPC method parsed from proto.
+type GraphProto struct {
+	Package       string `json:"package"`
+	Service       string `json:"service,omitempty"`
+	InputType     string `json:"input_type"`
+	OutputType    string `json:"output_type"`
+	GeneratedPath string `json:"generated_path"`
+}
+
+// GraphEdge is the dependency from the method to the other method,
+// or the subscription from the topic to the consumer.
+type GraphEdge struct {
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Kind        string           `json:"kind"`
+	Labels      []string         `json:"labels,omitempty"`
+	Conditional bool             `json:"conditional"`
+	InLoop      bool             `json:"in_loop"`
+	Async       bool             `json:"async"`
+	Interceptor string           `json:"interceptor,omitempty"`
+	Path        []*GraphCallSite `json:"path,omitempty"`
+	CallSites   []*GraphCallSite `json:"call_sites,omitempty"`
+}
+
+// GraphCallSite is the place calling the function on the way to the dependency.
+type GraphCallSite struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// NewGraph builds the whole dependency graph from methodMap. The failed services have the reason.
+func (r *Renderer) NewGraph(methodMap MethodMap, failures ...*AnalysisFailure) (*Graph, error) {
+	graph := &Graph{
+		Schema:        graphSchemaURL,
+		SchemaVersion: GraphSchemaVersion,
+		Services:      []*GraphService{},
+		Externals:     []*GraphMethod{},
+		Edges:         []*GraphEdge{},
+	}
+	// nodes are the ids of the methods in the graph, and targets are the methods depended on in order.
+	nodes := map[string]struct{}{}
+	targets := []*Method{}
+	addEdges := func(from *Method, analyzedMethod *AnalyzedMethod) {
+		for _, dep := range analyzedMethod.Dependencies {
+			graph.Edges = append(graph.Edges, newGraphEdge(from, dep))
+			targets = append(targets, dep.Method)
+			if !dep.Method.IsExternal() {
+				continue
+			}
+			id := dep.Method.MangledName()
+			if _, exists := nodes[id]; exists {
+				continue
+			}
+			nodes[id] = struct{}{}
+			graph.Externals = append(graph.Externals, newGraphMethod(dep.Method, nil))
+			if dep.Method.Kind != TopicMethodKind {
+				continue
+			}
+			for _, name := range sortedMethodNames(methodMap) {
+				consumer := methodMap[name]
+				if consumer.Entry == nil || !consumer.Subscribes(dep.Method) {
+					continue
+				}
+				graph.Edges = append(graph.Edges, &GraphEdge{
+					From: id,
+					To:   name,
+					Kind: subscribeEdgeKind,
+				})
+			}
+		}
+	}
+	for _, service := range r.cfg.Services {
+		mtds, err := service.Methods()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse proto file: %w", err)
+		}
+		gs := &GraphService{
+			Name:    service.Name,
+			Repo:    service.Repo,
+			Methods: []*GraphMethod{},
+		}
+		for _, failure := range failures {
+			if failure.Service == service.Name {
+				gs.Failure = failure.Reason
+			}
+		}
+		for _, mtd := range append(append([]*Method{}, mtds...), r.entries(service, methodMap)...) {
+			analyzedMethod := methodMap[mtd.MangledName()]
+			gs.Methods = append(gs.Methods, newGraphMethod(mtd, analyzedMethod))
+			nodes[mtd.MangledName()] = struct{}{}
+			if analyzedMethod != nil {
+				addEdges(mtd, analyzedMethod)
+			}
+		}
+		graph.Services = append(graph.Services, gs)
+	}
+	// every edge ends at the node, so the methods not found in the services ( e.g. RPCs of the services not defined ) are the externals.
+	for _, mtd := range targets {
+		id := mtd.MangledName()
+		if _, exists := nodes[id]; exists {
+			continue
+		}
+		nodes[id] = struct{}{}
+		graph.Externals = append(graph.Externals, newGraphMethod(mtd, nil))
+	}
+	sort.SliceStable(graph.Externals, func(i, j int) bool {
+		return graph.Externals[i].ID < graph.Externals[j].ID
+	})
+	return graph, nil
+}
+
+func newGraphMethod(mtd *Method, analyzedMethod *AnalyzedMethod) *GraphMethod {
+	gm := &GraphMethod{
+		ID:          mtd.MangledName(),
+		Kind:        mtd.Kind,
+		Service:     mtd.Service,
+		Name:        mtd.Name,
+		DisplayName: mtd.DisplayName(),
+		Access:      mtd.Access,
+	}
+	if mtd.IsGRPC() {
+		gm.Kind = grpcKindName
+		gm.Proto = &GraphProto{
+			Package:       mtd.Pkg,
+			Service:       mtd.ProtoService,
+			InputType:     mtd.InputType,
+			OutputType:    mtd.OutputType,
+			GeneratedPath: mtd.GeneratedPath,
+		}
+	}
+	if analyzedMethod == nil {
+		return gm
+	}
+	gm.Analyzed = true
+	gm.SourceURL = analyzedMethod.SourceURL
+	gm.Binaries = analyzedMethod.Binaries
+	for _, topic := range analyzedMethod.Subscriptions {
+		gm.Subscriptions = append(gm.Subscriptions, topic.MangledName())
+	}
+	return gm
+}
+
+func newGraphEdge(from *Method, dep *Dependency) *GraphEdge {
+	return &GraphEdge{
+		From:        from.MangledName(),
+		To:          dep.Method.MangledName(),
+		Kind:        dependEdgeKind,
+		Labels:      dep.Labels(),
+		Conditional: dep.Conditional,
+		InLoop:      dep.InLoop,
+		Async:       dep.Async,
+		Interceptor: dep.Interceptor,
+		Path:        newGraphCallSites(dep.Path),
+		CallSites:   newGraphCallSites(dep.CallSites),
+	}
+}
+
+func newGraphCallSites(sites []*CallSite) []*GraphCallSite {
+	if len(sites) == 0 {
+		return nil
+	}
+	graphSites := make([]*GraphCallSite, 0, len(sites))
+	for _, site := range sites {
+		graphSites = append(graphSites, &GraphCallSite{
+			Caller: site.Caller,
+			Callee: site.Callee,
+			File:   site.File,
+			Line:   site.Line,
+			URL:    site.URL,
+		})
+	}
+	return graphSites
+}
+
+func sortedMethodNames(methodMap MethodMap) []string {
+	names := make([]string, 0, len(methodMap))
+	for name := range methodMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderJSON writes the whole dependency graph to <output>.json .
+func (r *Renderer) renderJSON(methodMap MethodMap, failures []*AnalysisFailure) error {
+	graph, err := r.NewGraph(methodMap, failures...)
+	if err != nil {
+		return xerrors.Errorf("failed to create graph: %w", err)
+	}
+	b, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("failed to marshal graph: %w", err)
+	}
+	if err := ioutil.WriteFile(fmt.Sprintf("%s.json", r.cfg.Output), append(b, '\n'), 0644); err != nil {
+		return xerrors.Errorf("failed to write %s.json: %w", r.cfg.Output, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package servicetracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schemaValidator validates the JSON value by the subset of JSON Schema draft-07 used by schema/graph.schema.json .
+// The properties not declared by the schema are also reported, so the schema documents every field of the export.
+type schemaValidator struct {
+	root map[string]interface{}
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, exists := schema["$ref"].(string); exists {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		definition, ok := v.root["definitions"].(map[string]interface{})[name].(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown $ref %s", path, ref)}
+		}
+		return v.validate(definition, value, path)
+	}
+	errs := []string{}
+	if typ, exists := schema["type"].(string); exists && !matchSchemaType(typ, value) {
+		return append(errs, fmt.Sprintf("%s: %v is not %s", path, value, typ))
+	}
+	if c, exists := schema["const"]; exists && !reflect.DeepEqual(c, value) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not %v", path, value, c))
+	}
+	if enum, exists := schema["enum"].([]interface{}); exists {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, value)
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: %v is not in %v", path, value, enum))
+		}
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, exists := value[name.(string)]; !exists {
+				errs = append(errs, fmt.Sprintf("%s: %s is required", path, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, exists := properties[name].(map[string]interface{})
+			if !exists {
+				errs = append(errs, fmt.Sprintf("%s: %s is not declared", path, name))
+				continue
+			}
+			errs = append(errs, v.validate(property, value[name], path+"."+name)...)
+		}
+	case []interface{}:
+		if items, exists := schema["items"].(map[string]interface{}); exists {
+			for i, item := range value {
+				errs = append(errs, v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+func matchSchemaType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return false
+}
+
+func TestNewGraph(t *testing.T) {
+	cfg := orderFixtureConfig()
+	order, user := cfg.Services[0].mtds[0], cfg.Services[1].mtds[0]
+	billing := &Method{GeneratedPath: "github.com/example/proto/billing", Service: "billing", Name: "Charge", InputType: "ChargeRequest", OutputType: "ChargeResponse"}
+	topic := &Method{Kind: TopicMethodKind, Service: "pubsub", Name: "order-created"}
+	consumer := &Method{Kind: ConsumerMethodKind, Service: "order", Name: "onOrderCreated"}
+	methodMap := MethodMap{
+		order.MangledName(): &AnalyzedMethod{
+			SourceURL: "https://github.com/example/svc/blob/master/server.go#L10",
+			Binaries:  []string{"cmd/server"},
+			Dependencies: []*Dependency{
+				{Method: user, Path: []*CallSite{{Caller: "GetOrder", Callee: "GetUser", File: "server.go", Line: 12, URL: "https://github.com/example/svc/blob/master/server.go#L12"}}},
+				{Method: billing, Conditional: true},
+				{Method: &Method{Kind: HTTPMethodKind, Service: "api.example.com", Name: "GET /v1/rates"}, Async: true},
+				{Method: topic},
+				{Method: &Method{Kind: "redis", Service: "cache", Name: "order:*"}},
+			},
+		},
+		consumer.MangledName(): &AnalyzedMethod{
+			Entry:         consumer,
+			Subscriptions: []*Method{topic},
+			Dependencies:  []*Dependency{{Method: &Method{Kind: TableMethodKind, Service: "db", Name: "orders", Access: "write"}}},
+		},
+	}
+	graph, err := NewRenderer(cfg).NewGraph(methodMap, &AnalysisFailure{Service: "user", Reason: "timed out"})
+	if err != nil {
+		t.Fatalf("failed to create graph: %+v", err)
+	}
+
+	t.Run("edge endpoints", func(t *testing.T) {
+		nodes := map[string]struct{}{}
+		for _, service := range graph.Services {
+			for _, mtd := range service.Methods {
+				nodes[mtd.ID] = struct{}{}
+			}
+		}
+		for _, mtd := range graph.Externals {
+			if _, exists := nodes[mtd.ID]; exists {
+				t.Errorf("%s is duplicated", mtd.ID)
+			}
+			nodes[mtd.ID] = struct{}{}
+		}
+		for _, edge := range graph.Edges {
+			for _, id := range []string{edge.From, edge.To} {
+				if _, exists := nodes[id]; !exists {
+					t.Errorf("%s of the edge %s -> %s is not the node", id, edge.From, edge.To)
+				}
+			}
+		}
+		// the topic subscribed by the consumer is linked to it.
+		found := false
+		for _, edge := range graph.Edges {
+			found = found || (edge.Kind == subscribeEdgeKind && edge.From == topic.MangledName() && edge.To == consumer.MangledName())
+		}
+		if !found {
+			t.Errorf("subscription of %s is not exported", consumer.Name)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		b, err := json.Marshal(graph)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err != nil {
+			t.Fatal(err)
+		}
+		file, err := ioutil.ReadFile("schema/graph.schema.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schema map[string]interface{}
+		if err := json.Unmarshal(file, &schema); err != nil {
+			t.Fatalf("failed to parse schema: %+v", err)
+		}
+		validator := &schemaValidator{root: schema}
+		for _, err := range validator.validate(schema, value, "$") {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,475 @@
+package servicetracer
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	fixtureRepo    = "github.com/example/svc"
+	fixtureRepoDir = "/src/github.com/example/svc"
+)
+
+// fixturePackages are the minimal stand-ins of the packages imported by the fixtures.
+// The fixtures don't import the standard library to keep the tests hermetic and fast.
+var fixturePackages = map[string]string{
+	"context": `package context
+
+type Context interface {
+	Done() <-chan struct{}
+	Err() error
+	Value(key interface{}) interface{}
+}
+
+type emptyCtx int
+
+func (emptyCtx) Done() <-chan struct{}             { return nil }
+func (emptyCtx) Err() error                        { return nil }
+func (emptyCtx) Value(key interface{}) interface{} { return nil }
+
+func Background() Context { return emptyCtx(0) }
+`,
+	"errors": `package errors
+
+type errorString struct{ s string }
+
+func (e *errorString) Error() string { return e.s }
+
+func New(text string) error { return &errorString{text} }
+`,
+	"net/http": `package http
+
+import "context"
+
+type Request struct {
+	Method string
+	URL    string
+	ctx    context.Context
+}
+
+type Response struct {
+	StatusCode int
+}
+
+type Client struct{}
+
+var DefaultClient = &Client{}
+
+func (c *Client) Do(req *Request) (*Response, error) { return c.send(req) }
+func (c *Client) Get(url string) (*Response, error) {
+	req, err := NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+func (c *Client) send(req *Request) (*Response, error) { return &Response{}, nil }
+
+func Get(url string) (*Response, error) { return DefaultClient.Get(url) }
+
+func NewRequest(method, url string, body interface{}) (*Request, error) {
+	return NewRequestWithContext(context.Background(), method, url, body)
+}
+
+func NewRequestWithContext(ctx context.Context, method, url string, body interface{}) (*Request, error) {
+	return &Request{Method: method, URL: url, ctx: ctx}, nil
+}
+
+type ResponseWriter interface {
+	Write([]byte) (int, error)
+}
+
+type Handler interface {
+	ServeHTTP(ResponseWriter, *Request)
+}
+
+type HandlerFunc func(ResponseWriter, *Request)
+
+func (f HandlerFunc) ServeHTTP(w ResponseWriter, r *Request) { f(w, r) }
+
+type ServeMux struct {
+	handlers map[string]Handler
+}
+
+func NewServeMux() *ServeMux { return &ServeMux{handlers: map[string]Handler{}} }
+
+func (mux *ServeMux) Handle(pattern string, handler Handler) { mux.handlers[pattern] = handler }
+func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+	mux.Handle(pattern, HandlerFunc(handler))
+}
+func (mux *ServeMux) ServeHTTP(w ResponseWriter, r *Request) {
+	if h, ok := mux.handlers[r.URL]; ok {
+		h.ServeHTTP(w, r)
+	}
+}
+
+var DefaultServeMux = NewServeMux()
+
+func Handle(pattern string, handler Handler) { DefaultServeMux.Handle(pattern, handler) }
+func HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+	DefaultServeMux.HandleFunc(pattern, handler)
+}
+
+func ListenAndServe(addr string, handler Handler) error {
+	if handler == nil {
+		handler = DefaultServeMux
+	}
+	handler.ServeHTTP(nil, &Request{URL: addr})
+	return nil
+}
+`,
+	"google.golang.org/grpc": `package grpc
+
+import "context"
+
+type CallOption interface{}
+
+type ClientConn struct{}
+
+func Dial(target string, opts ...DialOption) (*ClientConn, error) {
+	cc := &ClientConn{}
+	for _, opt := range opts {
+		opt.apply(cc)
+	}
+	return cc, nil
+}
+
+func (cc *ClientConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...CallOption) error {
+	return nil
+}
+
+type ClientConnInterface interface {
+	Invoke(ctx context.Context, method string, args, reply interface{}, opts ...CallOption) error
+}
+
+type UnaryServerInfo struct {
+	FullMethod string
+}
+
+type UnaryHandler func(ctx context.Context, req interface{}) (interface{}, error)
+
+type UnaryServerInterceptor func(ctx context.Context, req interface{}, info *UnaryServerInfo, handler UnaryHandler) (interface{}, error)
+
+type UnaryInvoker func(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, opts ...CallOption) error
+
+type UnaryClientInterceptor func(ctx context.Context, method string, req, reply interface{}, cc *ClientConn, invoker UnaryInvoker, opts ...CallOption) error
+
+type serverOptions struct {
+	unaryInts []UnaryServerInterceptor
+}
+
+type ServerOption interface {
+	apply(*serverOptions)
+}
+
+type funcServerOption struct {
+	f func(*serverOptions)
+}
+
+func (o *funcServerOption) apply(opts *serverOptions) { o.f(opts) }
+
+func UnaryInterceptor(i UnaryServerInterceptor) ServerOption {
+	return &funcServerOption{f: func(o *serverOptions) { o.unaryInts = append(o.unaryInts, i) }}
+}
+
+func ChainUnaryInterceptor(interceptors ...UnaryServerInterceptor) ServerOption {
+	return &funcServerOption{f: func(o *serverOptions) { o.unaryInts = append(o.unaryInts, interceptors...) }}
+}
+
+type DialOption interface {
+	apply(*ClientConn)
+}
+
+type funcDialOption struct {
+	f func(*ClientConn)
+}
+
+func (o *funcDialOption) apply(cc *ClientConn) { o.f(cc) }
+
+func WithUnaryInterceptor(f UnaryClientInterceptor) DialOption {
+	return &funcDialOption{f: func(cc *ClientConn) { f(context.Background(), "", nil, nil, cc, nil) }}
+}
+
+type MethodDesc struct {
+	MethodName string
+	Handler    func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor UnaryServerInterceptor) (interface{}, error)
+}
+
+type ServiceDesc struct {
+	ServiceName string
+	HandlerType interface{}
+	Methods     []MethodDesc
+}
+
+type ServiceRegistrar interface {
+	RegisterService(desc *ServiceDesc, impl interface{})
+}
+
+type Server struct {
+	opts     serverOptions
+	services map[string]*serviceInfo
+}
+
+type serviceInfo struct {
+	desc *ServiceDesc
+	impl interface{}
+}
+
+func NewServer(opt ...ServerOption) *Server {
+	s := &Server{services: map[string]*serviceInfo{}}
+	for _, o := range opt {
+		o.apply(&s.opts)
+	}
+	return s
+}
+
+func (s *Server) RegisterService(desc *ServiceDesc, impl interface{}) {
+	s.services[desc.ServiceName] = &serviceInfo{desc: desc, impl: impl}
+}
+
+func (s *Server) Serve() error {
+	for _, info := range s.services {
+		for _, md := range info.desc.Methods {
+			md.Handler(info.impl, context.Background(), func(interface{}) error { return nil }, nil)
+		}
+		for _, i := range s.opts.unaryInts {
+			i(context.Background(), nil, &UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+		}
+	}
+	return nil
+}
+`,
+	"connectrpc.com/connect": `package connect
+
+import "context"
+
+type Request[T interface{}] struct {
+	Msg *T
+}
+
+func NewRequest[T interface{}](message *T) *Request[T] { return &Request[T]{Msg: message} }
+
+type Response[T interface{}] struct {
+	Msg *T
+}
+
+func NewResponse[T interface{}](message *T) *Response[T] { return &Response[T]{Msg: message} }
+
+type Client[Req, Res interface{}] struct {
+	url string
+}
+
+func NewClient[Req, Res interface{}](url string) *Client[Req, Res] { return &Client[Req, Res]{url: url} }
+
+func (c *Client[Req, Res]) CallUnary(ctx context.Context, req *Request[Req]) (*Response[Res], error) {
+	return &Response[Res]{}, nil
+}
+`,
+	"golang.org/x/sync/errgroup": `package errgroup
+
+type Group struct {
+	err error
+}
+
+func (g *Group) Go(f func() error) {
+	go func() {
+		if err := f(); err != nil {
+			g.err = err
+		}
+	}()
+}
+
+func (g *Group) Wait() error { return g.err }
+`,
+}
+
+// fixtureDeclarations are the packages created from the declarations without the function bodies,
+// because the SSA builder of golang.org/x/tools in go.mod can't build generic functions.
+var fixtureDeclarations = map[string]struct{}{
+	"connectrpc.com/connect": {},
+}
+
+// fixtureImporter type-checks the packages of the fixture on demand.
+type fixtureImporter struct {
+	fset    *token.FileSet
+	sources map[string]string
+	pkgs    map[string]*types.Package
+	files   map[string][]*ast.File
+	infos   map[string]*types.Info
+	order   []string
+}
+
+func (i *fixtureImporter) Import(path string) (*types.Package, error) {
+	if pkg, exists := i.pkgs[path]; exists {
+		return pkg, nil
+	}
+	src, exists := i.sources[path]
+	if !exists {
+		return nil, fmt.Errorf("package %s is not in the fixture", path)
+	}
+	file, err := parser.ParseFile(i.fset, fixtureFileName(path), src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Implicits:  map[ast.Node]types.Object{},
+		Scopes:     map[ast.Node]*types.Scope{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	conf := &types.Config{
+		Importer: i,
+		Sizes:    &types.StdSizes{WordSize: 8, MaxAlign: 8},
+	}
+	pkg, err := conf.Check(path, i.fset, []*ast.File{file}, info)
+	if err != nil {
+		return nil, err
+	}
+	i.pkgs[path] = pkg
+	i.files[path] = []*ast.File{file}
+	i.infos[path] = info
+	i.order = append(i.order, path)
+	return pkg, nil
+}
+
+// fixtureFileName returns the file of the package in the fixture.
+// The packages of the fixture repository are placed under fixtureRepoDir, so their positions are relative to the service.
+func fixtureFileName(pkgPath string) string {
+	return path.Join("/src", pkgPath, path.Base(pkgPath)+".go")
+}
+
+// buildFixture builds the SSA program of the sources keyed by the package path together with fixturePackages.
+// It returns the main packages of the program.
+func buildFixture(t *testing.T, sources map[string]string) []*ssa.Package {
+	t.Helper()
+	prog := buildFixtureProgram(t, sources)
+	paths := make([]string, 0, len(sources))
+	for path := range sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	mains := []*ssa.Package{}
+	for _, path := range paths {
+		pkg := prog.ImportedPackage(path)
+		if pkg.Pkg.Name() == "main" && pkg.Func("main") != nil {
+			mains = append(mains, pkg)
+		}
+	}
+	return mains
+}
+
+// buildFixtureProgram builds the SSA program of the sources keyed by the package path together with fixturePackages.
+func buildFixtureProgram(t *testing.T, sources map[string]string) *ssa.Program {
+	t.Helper()
+	all := map[string]string{}
+	for path, src := range fixturePackages {
+		all[path] = src
+	}
+	for path, src := range sources {
+		all[path] = src
+	}
+	importer := &fixtureImporter{
+		fset:    token.NewFileSet(),
+		sources: all,
+		pkgs:    map[string]*types.Package{},
+		files:   map[string][]*ast.File{},
+		infos:   map[string]*types.Info{},
+	}
+	paths := make([]string, 0, len(sources))
+	for path := range sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if _, err := importer.Import(path); err != nil {
+			t.Fatalf("failed to type-check %s: %+v", path, err)
+		}
+	}
+	prog := ssa.NewProgram(importer.fset, 0)
+	for _, path := range importer.order {
+		if _, exists := fixtureDeclarations[path]; exists {
+			prog.CreatePackage(importer.pkgs[path], nil, nil, true)
+			continue
+		}
+		prog.CreatePackage(importer.pkgs[path], importer.files[path], importer.infos[path], true)
+	}
+	prog.Build()
+	return prog
+}
+
+// fixtureService returns the service of the fixture repository serving mtds. It is caller-only if mtds is empty.
+func fixtureService(name string, mtds ...*Method) *Service {
+	service := &Service{
+		Name:    name,
+		Repo:    fixtureRepo,
+		mtds:    append([]*Method{}, mtds...),
+		repoDir: fixtureRepoDir,
+	}
+	if len(mtds) != 0 {
+		service.Proto.Path = []string{"proto"}
+	}
+	return service
+}
+
+// analyzeFixture analyzes the main packages of the sources as the first service of cfg with the additional detectors.
+func analyzeFixture(t *testing.T, cfg *Config, sources map[string]string, detectors ...Detector) MethodMap {
+	t.Helper()
+	a := NewAnalyzer(cfg)
+	a.SetProgressReporter(&nopProgressReporter{})
+	for _, detector := range detectors {
+		a.RegisterDetector(detector)
+	}
+	return analyzeFixtureWith(t, a, cfg, sources)
+}
+
+// analyzeFixtureWith analyzes the fixture by a configured by the caller ( e.g. the message output ).
+func analyzeFixtureWith(t *testing.T, a *Analyzer, cfg *Config, sources map[string]string) MethodMap {
+	t.Helper()
+	service := cfg.Services[0]
+	mainPkgs := buildFixture(t, sources)
+	if len(mainPkgs) == 0 {
+		t.Fatal("no main packages in the fixture")
+	}
+	mtdMap, err := service.MethodNameMap()
+	if err != nil {
+		t.Fatalf("failed to get method map: %+v", err)
+	}
+	analyzedMethodMap := MethodMap{}
+	if err := a.analyzeProgram(context.Background(), service, mainPkgs, mtdMap, analyzedMethodMap); err != nil {
+		t.Fatalf("failed to analyze: %+v", err)
+	}
+	return analyzedMethodMap
+}
+
+type nopProgressReporter struct{}
+
+func (r *nopProgressReporter) Report(event *ProgressEvent) {}
+
+// dependencyNames returns the display names of the dependencies of the analyzed method.
+func dependencyNames(analyzedMethod *AnalyzedMethod) []string {
+	names := []string{}
+	for _, dep := range analyzedMethod.Dependencies {
+		names = append(names, dep.Method.DisplayName())
+	}
+	return names
+}
+
+// cmpStrings returns the description of the difference between expected and actual, or empty if they're equal.
+func cmpStrings(expected, actual []string) string {
+	if strings.Join(expected, "\n") == strings.Join(actual, "\n") {
+		return ""
+	}
+	return fmt.Sprintf("expected:\n\t%s\nactual:\n\t%s", strings.Join(expected, "\n\t"), strings.Join(actual, "\n\t"))
+}
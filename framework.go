@@ -0,0 +1,103 @@
+package servicetracer
+
+import (
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// framework recognizes the handler and client signatures of RPC framework.
+// messageTypes returns the request and response message types like "*github.com/org/proto/a.GetRequest".
+type framework interface {
+	messageTypes(sig *types.Signature) (string, string, bool)
+}
+
+var (
+	frameworks = []framework{&connectFramework{}, &grpcFramework{}}
+)
+
+// grpcFramework recognizes grpc-go and Twirp. Both handlers and clients have the same shape,
+// and Twirp generates them into the package of messages like protoc-gen-go-grpc.
+//
+//	func(ctx context.Context, req *Request, ...) (*Response, error)
+type grpcFramework struct{}
+
+func (f *grpcFramework) messageTypes(sig *types.Signature) (string, string, bool) {
+	params := sig.Params()
+	results := sig.Results()
+
+	// gRPC methods has two request parameters.
+	// First:  context.Context
+	// Second: custom request structure.
+	if params.Len() < 2 {
+		return "", "", false
+	}
+
+	// gRPC methods has two response parameters.
+	// First: custom response structure.
+	// Second: error
+	if results.Len() < 2 {
+		return "", "", false
+	}
+
+	// First argument of gRPC method expects context.Context.
+	if params.At(0).Type().String() != "context.Context" {
+		return "", "", false
+	}
+	req, resp := params.At(1).Type().String(), results.At(0).Type().String()
+	// the signature partially wrapped by connect-go isn't RPC.
+	if connectRequestPattern.MatchString(req) || connectResponsePattern.MatchString(resp) {
+		return "", "", false
+	}
+	return req, resp, true
+}
+
+var (
+	connectRequestPattern  = regexp.MustCompile(`^\*(?:connectrpc\.com/connect|github\.com/bufbuild/connect-go)\.Request\[(.+)\]$`)
+	connectResponsePattern = regexp.MustCompile(`^\*(?:connectrpc\.com/connect|github\.com/bufbuild/connect-go)\.Response\[(.+)\]$`)
+)
+
+// connectFramework recognizes connect-go. Messages are wrapped by connect.Request and connect.Response.
+//
+//	func(ctx context.Context, req *connect.Request[Request]) (*connect.Response[Response], error)
+type connectFramework struct{}
+
+func (f *connectFramework) messageTypes(sig *types.Signature) (string, string, bool) {
+	params := sig.Params()
+	results := sig.Results()
+	if params.Len() != 2 || results.Len() != 2 {
+		return "", "", false
+	}
+	if params.At(0).Type().String() != "context.Context" {
+		return "", "", false
+	}
+	req := connectRequestPattern.FindStringSubmatch(params.At(1).Type().String())
+	if req == nil {
+		return "", "", false
+	}
+	resp := connectResponsePattern.FindStringSubmatch(results.At(0).Type().String())
+	if resp == nil {
+		return "", "", false
+	}
+	return "*" + req[1], "*" + resp[1], true
+}
+
+// rpcMessageTypes returns the request and response message types recognized by one of the frameworks.
+func rpcMessageTypes(sig *types.Signature) (string, string, bool) {
+	for _, f := range frameworks {
+		if req, resp, ok := f.messageTypes(sig); ok {
+			return req, resp, true
+		}
+	}
+	return "", "", false
+}
+
+// messageTypePkgPath returns the package path of the message type like "*github.com/org/proto/a.GetRequest".
+func messageTypePkgPath(typ string) string {
+	typ = strings.TrimPrefix(typ, "*")
+	idx := strings.LastIndex(typ, ".")
+	if idx < 0 {
+		return ""
+	}
+	return typ[:idx]
+}
@@ -0,0 +1,244 @@
+package servicetracer
+
+import (
+	"go/types"
+	"testing"
+)
+
+const (
+	twirpOrderProto = `package order
+
+import (
+	"context"
+	"net/http"
+)
+
+type GetOrderRequest struct{ Id string }
+type GetOrderResponse struct{ UserName string }
+
+type OrderService interface {
+	GetOrder(context.Context, *GetOrderRequest) (*GetOrderResponse, error)
+}
+
+type TwirpServer interface {
+	ServeHTTP(http.ResponseWriter, *http.Request)
+}
+
+type orderServiceServer struct {
+	OrderService
+}
+
+func NewOrderServiceServer(svc OrderService) TwirpServer {
+	return &orderServiceServer{OrderService: svc}
+}
+
+func (s *orderServiceServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	s.serveGetOrder(context.Background(), resp, req)
+}
+
+func (s *orderServiceServer) serveGetOrder(ctx context.Context, resp http.ResponseWriter, req *http.Request) {
+	s.OrderService.GetOrder(ctx, &GetOrderRequest{})
+}
+`
+	twirpUserProto = `package user
+
+import (
+	"context"
+	"net/http"
+)
+
+type GetUserRequest struct{ Id string }
+type GetUserResponse struct{ Name string }
+
+type UserService interface {
+	GetUser(context.Context, *GetUserRequest) (*GetUserResponse, error)
+}
+
+type userServiceProtobufClient struct {
+	client *http.Client
+	url    string
+}
+
+func NewUserServiceProtobufClient(baseURL string, client *http.Client) UserService {
+	return &userServiceProtobufClient{client: client, url: baseURL + "/twirp/user.UserService/"}
+}
+
+func (c *userServiceProtobufClient) GetUser(ctx context.Context, in *GetUserRequest) (*GetUserResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url+"GetUser", nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.client.Do(req); err != nil {
+		return nil, err
+	}
+	return &GetUserResponse{}, nil
+}
+`
+	billingProto = `package billing
+
+type ChargeRequest struct{ OrderId string }
+type ChargeResponse struct{}
+`
+	billingConnect = `package billingconnect
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/example/proto/billing"
+)
+
+type BillingServiceClient interface {
+	Charge(context.Context, *connect.Request[billing.ChargeRequest]) (*connect.Response[billing.ChargeResponse], error)
+}
+
+type billingServiceClient struct {
+	url string
+}
+
+func NewBillingServiceClient(baseURL string) BillingServiceClient {
+	return &billingServiceClient{url: baseURL}
+}
+
+func (c *billingServiceClient) Charge(ctx context.Context, req *connect.Request[billing.ChargeRequest]) (*connect.Response[billing.ChargeResponse], error) {
+	return nil, nil
+}
+`
+	frameworkServer = `package main
+
+import (
+	"context"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/example/proto/billing"
+	"github.com/example/proto/billing/billingconnect"
+	"github.com/example/proto/order"
+	"github.com/example/proto/user"
+)
+
+type server struct {
+	user    user.UserService
+	billing billingconnect.BillingServiceClient
+}
+
+func (s *server) GetOrder(ctx context.Context, req *order.GetOrderRequest) (*order.GetOrderResponse, error) {
+	resp, err := s.user.GetUser(ctx, &user.GetUserRequest{Id: req.Id})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.billing.Charge(ctx, &connect.Request[billing.ChargeRequest]{Msg: &billing.ChargeRequest{OrderId: req.Id}}); err != nil {
+		return nil, err
+	}
+	return &order.GetOrderResponse{UserName: resp.Name}, nil
+}
+
+func main() {
+	s := &server{
+		user:    user.NewUserServiceProtobufClient("http://user", &http.Client{}),
+		billing: billingconnect.NewBillingServiceClient("http://billing"),
+	}
+	http.ListenAndServe(":8080", order.NewOrderServiceServer(s))
+}
+`
+)
+
+func TestRPCMessageTypes(t *testing.T) {
+	prog := buildFixtureProgram(t, map[string]string{
+		"github.com/example/proto/billing":                billingProto,
+		"github.com/example/proto/billing/billingconnect": billingConnect,
+		"github.com/example/proto/order":                  orderProto,
+		"github.com/example/proto/user":                   userProto,
+		fixtureRepo + "/rpc": `package rpc
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/example/proto/billing"
+	"github.com/example/proto/order"
+	"github.com/example/proto/user"
+	"google.golang.org/grpc"
+)
+
+func GRPCHandler(ctx context.Context, req *order.GetOrderRequest) (*order.GetOrderResponse, error) {
+	return nil, nil
+}
+
+func GRPCClient(ctx context.Context, in *user.GetUserRequest, opts ...grpc.CallOption) (*user.GetUserResponse, error) {
+	return nil, nil
+}
+
+func ConnectHandler(ctx context.Context, req *connect.Request[billing.ChargeRequest]) (*connect.Response[billing.ChargeResponse], error) {
+	return nil, nil
+}
+
+func NoContext(req *order.GetOrderRequest) (*order.GetOrderResponse, error) {
+	return nil, nil
+}
+
+func NoError(ctx context.Context, req *order.GetOrderRequest) *order.GetOrderResponse {
+	return nil
+}
+
+func ConnectNoResponse(ctx context.Context, req *connect.Request[billing.ChargeRequest]) (*billing.ChargeResponse, error) {
+	return nil, nil
+}
+`,
+	})
+	pkg := prog.ImportedPackage(fixtureRepo + "/rpc").Pkg
+	tests := []struct {
+		fn   string
+		req  string
+		resp string
+		ok   bool
+	}{
+		{fn: "GRPCHandler", req: "*github.com/example/proto/order.GetOrderRequest", resp: "*github.com/example/proto/order.GetOrderResponse", ok: true},
+		{fn: "GRPCClient", req: "*github.com/example/proto/user.GetUserRequest", resp: "*github.com/example/proto/user.GetUserResponse", ok: true},
+		{fn: "ConnectHandler", req: "*github.com/example/proto/billing.ChargeRequest", resp: "*github.com/example/proto/billing.ChargeResponse", ok: true},
+		{fn: "NoContext"},
+		{fn: "NoError"},
+		{fn: "ConnectNoResponse"},
+	}
+	for _, test := range tests {
+		t.Run(test.fn, func(t *testing.T) {
+			sig := pkg.Scope().Lookup(test.fn).Type().(*types.Signature)
+			req, resp, ok := rpcMessageTypes(sig)
+			if ok != test.ok || req != test.req || resp != test.resp {
+				t.Errorf("expected (%s, %s, %t) but got (%s, %s, %t)", test.req, test.resp, test.ok, req, resp, ok)
+			}
+		})
+	}
+}
+
+func TestAnalyzeTwirpAndConnect(t *testing.T) {
+	cfg := orderFixtureConfig()
+	cfg.Services = append(cfg.Services, fixtureService("billing", &Method{
+		GeneratedPath: "github.com/example/proto/billing",
+		Service:       "billing",
+		Name:          "Charge",
+		InputType:     "ChargeRequest",
+		OutputType:    "ChargeResponse",
+		ProtoService:  "BillingService",
+	}))
+	methodMap := analyzeFixture(t, cfg, map[string]string{
+		"github.com/example/proto/billing":                billingProto,
+		"github.com/example/proto/billing/billingconnect": billingConnect,
+		"github.com/example/proto/order":                  twirpOrderProto,
+		"github.com/example/proto/user":                   twirpUserProto,
+		fixtureRepo + "/cmd/server":                       frameworkServer,
+	})
+	analyzedMethod, exists := methodMap["order.getorder.getorderrequest.getorderresponse"]
+	if !exists {
+		t.Fatalf("the Twirp handler is not analyzed: %v", methodMap)
+	}
+	// the request sent by net/http in the Twirp client isn't reported as the HTTP dependency.
+	if diff := cmpStrings([]string{"billing.Charge", "user.GetUser"}, dependencyNames(analyzedMethod)); diff != "" {
+		t.Errorf("unexpected dependencies: %s", diff)
+	}
+	for _, dep := range analyzedMethod.Dependencies {
+		if dep.Method.Name == "Charge" && dep.Method.GeneratedPath != "github.com/example/proto/billing" {
+			t.Errorf("the connect client isn't resolved by the package of messages: %s", dep.Method.GeneratedPath)
+		}
+	}
+}
@@ -11,7 +11,6 @@ require (
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/jhump/protoreflect v1.7.0
 	github.com/mattn/go-colorable v0.1.8 // indirect
-	github.com/rs/xid v1.2.1
 	github.com/stretchr/testify v1.6.1 // indirect
 	golang.org/x/sys v0.0.0-20200905004654-be1d3432aa8f // indirect
 	golang.org/x/text v0.3.3 // indirect
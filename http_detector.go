@@ -0,0 +1,113 @@
+package servicetracer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	httpPkgPath = "net/http"
+)
+
+// HTTPDetector detects HTTP requests sent by net/http client.
+// The host and the path of the request are recovered from constants as far as possible.
+//
+// Requests are detected where the URL is given ( http.NewRequest, http.Get, (*http.Client).Post and so on ).
+// (*http.Client).Do is detected only if the request is built without http.NewRequest,
+// because the request made by http.NewRequest is already detected.
+// The request given as the parameter is reported as the unresolved request, because it may be built anywhere.
+type HTTPDetector struct{}
+
+func (d *HTTPDetector) Name() string {
+	return "http"
+}
+
+func (d *HTTPDetector) Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	if edge.Site == nil || nodeToPkgPath(edge.Callee) != httpPkgPath {
+		return nil, nil
+	}
+	// ignore requests sent inside of net/http package ( e.g. http.Get calls http.NewRequest ).
+	if nodeToPkgPath(edge.Caller) == httpPkgPath {
+		return nil, nil
+	}
+	fn := edge.Callee.Func
+	args := callArgs(edge.Site, fn)
+	switch relFuncName(fn) {
+	case "NewRequest", "NewRequestWithContext":
+		if fn.Name() == "NewRequestWithContext" {
+			args = args[1:]
+		}
+		method, _ := resolveString(args[0])
+		url, _ := resolveString(args[1])
+		return []*Method{d.method(method, url)}, nil
+	case "Get", "(*Client).Get":
+		return []*Method{d.methodByURL(http.MethodGet, args[0])}, nil
+	case "Head", "(*Client).Head":
+		return []*Method{d.methodByURL(http.MethodHead, args[0])}, nil
+	case "Post", "(*Client).Post", "PostForm", "(*Client).PostForm":
+		return []*Method{d.methodByURL(http.MethodPost, args[0])}, nil
+	case "(*Client).Do":
+		if d.isNewRequest(args[0]) {
+			return nil, nil
+		}
+		return []*Method{d.method(unresolvedPart, unresolvedPart)}, nil
+	}
+	return nil, nil
+}
+
+func (d *HTTPDetector) methodByURL(method string, v ssa.Value) *Method {
+	url, _ := resolveString(v)
+	return d.method(method, url)
+}
+
+// isNewRequest reports whether v is the request returned by http.NewRequest.
+func (d *HTTPDetector) isNewRequest(v ssa.Value) bool {
+	extract, ok := v.(*ssa.Extract)
+	if !ok {
+		return false
+	}
+	call, ok := extract.Tuple.(*ssa.Call)
+	if !ok {
+		return false
+	}
+	fn := call.Common().StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != httpPkgPath {
+		return false
+	}
+	return fn.Name() == "NewRequest" || fn.Name() == "NewRequestWithContext"
+}
+
+func (d *HTTPDetector) method(method, url string) *Method {
+	host, path := d.splitURL(url)
+	return &Method{
+		Kind:    HTTPMethodKind,
+		Service: host,
+		Name:    fmt.Sprintf("%s %s", strings.ToUpper(method), path),
+	}
+}
+
+// splitURL splits url into the host and the path. Query and fragment are removed.
+func (d *HTTPDetector) splitURL(url string) (string, string) {
+	if idx := strings.IndexAny(url, "?#"); idx >= 0 {
+		url = url[:idx]
+	}
+	idx := strings.Index(url, "://")
+	if idx < 0 {
+		// scheme and host are unknown ( e.g. baseURL + "/v1/users" ).
+		path := strings.TrimPrefix(url, unresolvedPart)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return unresolvedPart, path
+	}
+	rest := url[idx+len("://"):]
+	slash := strings.Index(rest, "/")
+	if slash < 0 {
+		return rest, "/"
+	}
+	return rest[:slash], rest[slash:]
+}
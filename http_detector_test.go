@@ -0,0 +1,75 @@
+package servicetracer
+
+import (
+	"testing"
+)
+
+const httpFixture = `package main
+
+import (
+	"net/http"
+)
+
+var baseURL = "https://" + host()
+
+func host() string { return "" }
+
+func getUsers() {
+	http.Get("https://api.example.com/v1/users?limit=10")
+}
+
+func createOrder() {
+	req, _ := http.NewRequest("POST", baseURL+"/v1/orders", nil)
+	http.DefaultClient.Do(req)
+}
+
+func send(req *http.Request) {
+	http.DefaultClient.Do(req)
+}
+
+func main() {
+	getUsers()
+	createOrder()
+	send(&http.Request{Method: "DELETE", URL: "https://api.example.com/v1/orders/1"})
+}
+`
+
+func TestHTTPDetector(t *testing.T) {
+	methodMap := analyzeFixture(t, &Config{Services: []*Service{fixtureService("job")}}, map[string]string{
+		fixtureRepo + "/cmd/job": httpFixture,
+	})
+	analyzedMethod := methodMap["caller:job.cmd/job.main"]
+	if analyzedMethod == nil {
+		t.Fatalf("main is not analyzed: %v", methodMap)
+	}
+	expected := []string{
+		"* * /",
+		"* POST /v1/orders",
+		"api.example.com GET /v1/users",
+	}
+	if diff := cmpStrings(expected, dependencyNames(analyzedMethod)); diff != "" {
+		t.Errorf("unexpected dependencies: %s", diff)
+	}
+}
+
+func TestSplitURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+		path string
+	}{
+		{url: "https://api.example.com/v1/users", host: "api.example.com", path: "/v1/users"},
+		{url: "http://api.example.com", host: "api.example.com", path: "/"},
+		{url: "https://api.example.com/v1/users?limit=10#top", host: "api.example.com", path: "/v1/users"},
+		{url: "*/v1/users", host: "*", path: "/v1/users"},
+		{url: "v1/users", host: "*", path: "/v1/users"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			host, path := (&HTTPDetector{}).splitURL(test.url)
+			if host != test.host || path != test.path {
+				t.Errorf("expected %s %s but got %s %s", test.host, test.path, host, path)
+			}
+		})
+	}
+}
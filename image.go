@@ -0,0 +1,244 @@
+package servicetracer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"html/template"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-graphviz"
+	"golang.org/x/xerrors"
+)
+
+const (
+	indexFileName = "index.html"
+	// pointsPerPixel converts the pixels rendered by graphviz at 96 dpi into the points of PDF.
+	pointsPerPixel = 72.0 / 96.0
+)
+
+var (
+	imageFormats = map[string]graphviz.Format{
+		SVGFormat: graphviz.SVG,
+		PNGFormat: graphviz.PNG,
+	}
+	// directoryFormats are the formats written to the directory named output.
+	directoryFormats = map[string]string{
+		DOTFormat:      "dot",
+		MermaidFormat:  "mmd",
+		PlantUMLFormat: "puml",
+		SVGFormat:      "svg",
+		PNGFormat:      "png",
+		PDFFormat:      "pdf",
+	}
+)
+
+// renderImages writes the diagrams as the images to the directory named output.
+// go-graphviz has no PDF renderer, so PDF embeds the image rendered as PNG.
+func (r *Renderer) renderImages(format string, methodMap MethodMap) error {
+	return r.eachDiagram(methodMap, func(name string, d *diagram) error {
+		var b bytes.Buffer
+		if err := r.renderImage(&b, format, d); err != nil {
+			return xerrors.Errorf("failed to render image: %w", err)
+		}
+		path := filepath.Join(r.cfg.Output, fmt.Sprintf("%s.%s", name, format))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return xerrors.Errorf("failed to create directory: %w", err)
+		}
+		if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+			return xerrors.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func (r *Renderer) renderImage(w io.Writer, format string, d *diagram) (e error) {
+	var dot bytes.Buffer
+	writeDOT(&dot, d)
+	graph, err := graphviz.ParseBytes(dot.Bytes())
+	if err != nil {
+		return xerrors.Errorf("failed to parse DOT: %w", err)
+	}
+	g := graphviz.New()
+	defer func() {
+		if err := graph.Close(); err != nil && e == nil {
+			e = xerrors.Errorf("failed to close graphviz graph: %w", err)
+		}
+		g.Close()
+	}()
+	if format == PDFFormat {
+		img, err := g.RenderImage(graph)
+		if err != nil {
+			return xerrors.Errorf("failed to render image: %w", err)
+		}
+		if err := writePDF(w, img); err != nil {
+			return xerrors.Errorf("failed to write PDF: %w", err)
+		}
+		return nil
+	}
+	imageFormat, exists := imageFormats[format]
+	if !exists {
+		return xerrors.Errorf("unknown image format %s", format)
+	}
+	if err := g.Render(graph, imageFormat, w); err != nil {
+		return xerrors.Errorf("failed to render %s: %w", format, err)
+	}
+	return nil
+}
+
+// writePDF writes the single page PDF showing img.
+// The page is the raster image, so the text can't be selected or searched and it blurs when zoomed in.
+func writePDF(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var pixels bytes.Buffer
+	zw := zlib.NewWriter(&pixels)
+	row := make([]byte, 0, width*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// composite over white background, because PDF image has no alpha here.
+			red, green, blue, alpha := img.At(x, y).RGBA()
+			bg := 0xffff - alpha
+			row = append(row, byte((red+bg)>>8), byte((green+bg)>>8), byte((blue+bg)>>8))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return xerrors.Errorf("failed to compress image: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return xerrors.Errorf("failed to compress image: %w", err)
+	}
+	pageWidth, pageHeight := float64(width)*pointsPerPixel, float64(height)*pointsPerPixel
+	contents := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", pageWidth, pageHeight)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", width, height, pixels.Len(), pixels.String()),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(contents), contents),
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, 0, len(objects))
+	for idx, obj := range objects {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", idx+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return xerrors.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+type indexParam struct {
+	Diagrams []*indexDiagram
+}
+
+type indexDiagram struct {
+	Name    string
+	Preview string
+	Files   []*indexFile
+	Methods []*indexDiagram
+}
+
+type indexFile struct {
+	Format string
+	Path   string
+}
+
+// renderIndex writes index.html linking to the files of the diagrams written in the formats.
+// The image of the whole system and each service is shown as the overview if it's written in SVG or PNG.
+func (r *Renderer) renderIndex(formats []string, methodMap MethodMap) error {
+	exts := []string{}
+	for _, format := range formats {
+		if ext, exists := directoryFormats[format]; exists {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		return nil
+	}
+	newDiagram := func(title, name string) *indexDiagram {
+		d := &indexDiagram{Name: title}
+		for _, ext := range exts {
+			file := &indexFile{Format: ext, Path: fmt.Sprintf("%s.%s", name, ext)}
+			d.Files = append(d.Files, file)
+			if d.Preview == "" && (ext == SVGFormat || ext == PNGFormat) {
+				d.Preview = file.Path
+			}
+		}
+		return d
+	}
+	param := &indexParam{}
+	param.Diagrams = append(param.Diagrams, newDiagram(systemDiagramName, systemDiagramName))
+	// the names are assigned in the same order as eachDiagram.
+	names := newDiagramNames()
+	for _, service := range r.cfg.Services {
+		serviceName := names.service(service)
+		d := newDiagram(service.Name, serviceName)
+		mtds, err := r.serviceMethods(service, methodMap)
+		if err != nil {
+			return xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			title := mtd.Name
+			if mtd.ProtoService != "" {
+				title = fmt.Sprintf("%s.%s", mtd.ProtoService, mtd.Name)
+			}
+			d.Methods = append(d.Methods, newDiagram(title, names.method(serviceName, mtd)))
+		}
+		param.Diagrams = append(param.Diagrams, d)
+	}
+	tmpl, err := template.New(indexFileName).Parse(indexHTML)
+	if err != nil {
+		return xerrors.Errorf("failed to parse template HTML: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, param); err != nil {
+		return xerrors.Errorf("failed to execute template: %w", err)
+	}
+	if err := os.MkdirAll(r.cfg.Output, 0755); err != nil {
+		return xerrors.Errorf("failed to create directory: %w", err)
+	}
+	path := filepath.Join(r.cfg.Output, indexFileName)
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return xerrors.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+const indexHTML = `<html>
+  <head>
+    <meta charset="utf-8">
+    <title>go-service-tracer</title>
+  </head>
+  <body>
+    {{- range .Diagrams }}
+    <h2>{{ .Name }}</h2>
+    <p>{{ range .Files }}<a href="{{ .Path }}">{{ .Format }}</a> {{ end }}</p>
+    {{- if .Preview }}
+    <a href="{{ .Preview }}"><img src="{{ .Preview }}" style="max-width:100%"></a>
+    {{- end }}
+    {{- if .Methods }}
+    <ul>
+      {{- range .Methods }}
+      <li>{{ .Name }} {{ range .Files }}<a href="{{ .Path }}">{{ .Format }}</a> {{ end }}</li>
+      {{- end }}
+    </ul>
+    {{- end }}
+    {{- end }}
+  </body>
+</html>
+`
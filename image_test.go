@@ -0,0 +1,102 @@
+package servicetracer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pdfObject returns the body of the object num at offset, checking that the xref entry points to it.
+func pdfObject(t *testing.T, pdf []byte, num, offset int) string {
+	t.Helper()
+	header := fmt.Sprintf("%d 0 obj\n", num)
+	if offset >= len(pdf) || !bytes.HasPrefix(pdf[offset:], []byte(header)) {
+		t.Fatalf("xref of object %d points to %d, not the object", num, offset)
+	}
+	body := string(pdf[offset+len(header):])
+	end := strings.Index(body, "\nendobj\n")
+	if end < 0 {
+		t.Fatalf("object %d isn't terminated", num)
+	}
+	return body[:end]
+}
+
+func TestWritePDF(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.NRGBA{R: 0xff, A: 0xff})
+	img.Set(1, 0, color.NRGBA{G: 0xff, A: 0xff})
+	img.Set(2, 0, color.NRGBA{B: 0xff, A: 0xff})
+	img.Set(0, 1, color.NRGBA{A: 0xff})
+	// the transparent pixels are composited over white.
+	img.Set(1, 1, color.NRGBA{})
+	img.Set(2, 1, color.NRGBA{A: 0x80})
+
+	var b bytes.Buffer
+	if err := writePDF(&b, img); err != nil {
+		t.Fatalf("failed to write PDF: %+v", err)
+	}
+	pdf := b.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) {
+		t.Fatalf("unexpected header: %q", pdf[:16])
+	}
+
+	trailer := regexp.MustCompile(`trailer\n<< /Size (\d+) /Root 1 0 R >>\nstartxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if trailer == nil {
+		t.Fatalf("unexpected trailer: %q", pdf[len(pdf)-64:])
+	}
+	size, _ := strconv.Atoi(string(trailer[1]))
+	xref, _ := strconv.Atoi(string(trailer[2]))
+	xrefHeader := fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", size)
+	if !bytes.HasPrefix(pdf[xref:], []byte(xrefHeader)) {
+		t.Fatalf("startxref %d doesn't point to the xref table", xref)
+	}
+	entries := strings.Split(string(pdf[xref+len(xrefHeader):]), "\n")[:size-1]
+	objects := map[int]string{}
+	for idx, entry := range entries {
+		// each entry is 20 bytes including the end of line.
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("unexpected xref entry %q", entry)
+		}
+		offset, err := strconv.Atoi(entry[:10])
+		if err != nil {
+			t.Fatalf("unexpected xref offset %q", entry)
+		}
+		objects[idx+1] = pdfObject(t, pdf, idx+1, offset)
+	}
+
+	if objects[1] != "<< /Type /Catalog /Pages 2 0 R >>" {
+		t.Errorf("unexpected catalog: %s", objects[1])
+	}
+	if !strings.Contains(objects[3], fmt.Sprintf("/MediaBox [0 0 %.2f %.2f]", 3*pointsPerPixel, 2*pointsPerPixel)) {
+		t.Errorf("unexpected page: %s", objects[3])
+	}
+	stream := regexp.MustCompile(`(?s)^<< /Type /XObject /Subtype /Image /Width 3 /Height 2 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length (\d+) >>\nstream\n(.*)\nendstream$`).FindStringSubmatch(objects[4])
+	if stream == nil {
+		t.Fatalf("unexpected image: %q", objects[4][:128])
+	}
+	if length, _ := strconv.Atoi(stream[1]); length != len(stream[2]) {
+		t.Errorf("/Length %d is not the length of the stream %d", length, len(stream[2]))
+	}
+	zr, err := zlib.NewReader(strings.NewReader(stream[2]))
+	if err != nil {
+		t.Fatalf("failed to decompress image: %+v", err)
+	}
+	pixels, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress image: %+v", err)
+	}
+	expected := []byte{
+		0xff, 0x00, 0x00, 0x00, 0xff, 0x00, 0x00, 0x00, 0xff,
+		0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x7f, 0x7f, 0x7f,
+	}
+	if !bytes.Equal(expected, pixels) {
+		t.Errorf("unexpected pixels: %x", pixels)
+	}
+}
@@ -0,0 +1,374 @@
+package servicetracer
+
+import (
+	"go/types"
+	"regexp"
+	"sort"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/xerrors"
+)
+
+const (
+	grpcPkgPath = "google.golang.org/grpc"
+)
+
+var (
+	registerServerPattern = regexp.MustCompile(`^Register(\w+)Server$`)
+
+	// interceptorOptions maps the option functions of grpc to whether the interceptors are client side.
+	interceptorOptions = map[string]bool{
+		"UnaryInterceptor":           false,
+		"ChainUnaryInterceptor":      false,
+		"StreamInterceptor":          false,
+		"ChainStreamInterceptor":     false,
+		"WithUnaryInterceptor":       true,
+		"WithChainUnaryInterceptor":  true,
+		"WithStreamInterceptor":      true,
+		"WithChainStreamInterceptor": true,
+	}
+
+	// continuationTypes are the types of the parameters which continue the RPC in the interceptor.
+	// The traversal from the interceptor doesn't follow them to not reach every handler or RPC.
+	continuationTypes = map[string]struct{}{
+		grpcPkgPath + ".UnaryHandler":  {},
+		grpcPkgPath + ".StreamHandler": {},
+		grpcPkgPath + ".UnaryInvoker":  {},
+		grpcPkgPath + ".Streamer":      {},
+	}
+)
+
+type interceptor struct {
+	name     string
+	client   bool
+	roots    []*callgraph.Node
+	binaries []string
+	// servers are the grpc.NewServer calls given the server interceptor. It's empty if they aren't known.
+	servers []*ssa.Call
+}
+
+// registration is the implementation of the service registered to the servers by Register<Service>Server.
+type registration struct {
+	service string
+	impl    types.Type
+	servers []*ssa.Call
+}
+
+// detectInterceptors finds the interceptors passed to grpc.NewServer or grpc.Dial by the option functions.
+func (a *Analyzer) detectInterceptors(cg *callgraph.Graph) ([]*interceptor, error) {
+	interceptors := []*interceptor{}
+	if err := callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
+		if edge.Site == nil || nodeToPkgPath(edge.Callee) != grpcPkgPath || edge.Callee.Func.Signature.Recv() != nil {
+			return nil
+		}
+		if nodeToPkgPath(edge.Caller) == grpcPkgPath {
+			return nil
+		}
+		client, exists := interceptorOptions[edge.Callee.Func.Name()]
+		if !exists {
+			return nil
+		}
+		var servers []*ssa.Call
+		if option := edge.Site.Value(); option != nil && !client {
+			servers = a.optionServers(cg, option, 0)
+		}
+		for _, arg := range edge.Site.Common().Args {
+			for _, fn := range a.interceptorFuncs(arg, 0) {
+				node, exists := cg.Nodes[fn]
+				if !exists {
+					continue
+				}
+				interceptors = append(interceptors, &interceptor{
+					name:    relFuncName(fn),
+					client:  client,
+					roots:   []*callgraph.Node{node},
+					servers: servers,
+				})
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to walk edges: %w", err)
+	}
+	// the first interceptor calling the method is recorded as Dependency.Interceptor, so sort them to be deterministic.
+	sort.SliceStable(interceptors, func(i, j int) bool {
+		if interceptors[i].name != interceptors[j].name {
+			return interceptors[i].name < interceptors[j].name
+		}
+		return !interceptors[i].client && interceptors[j].client
+	})
+	return interceptors, nil
+}
+
+// interceptorFuncs resolves the interceptor value into the functions.
+// The interceptor made by the constructor ( e.g. auth.UnaryServerInterceptor(client) ) is resolved into the returned closures.
+func (a *Analyzer) interceptorFuncs(v ssa.Value, depth int) []*ssa.Function {
+	if depth > maxResolveDepth {
+		return nil
+	}
+	switch value := v.(type) {
+	case *ssa.Function:
+		return []*ssa.Function{declaredFunc(value)}
+	case *ssa.MakeClosure:
+		return a.interceptorFuncs(value.Fn, depth+1)
+	case *ssa.ChangeType:
+		return a.interceptorFuncs(value.X, depth+1)
+	case *ssa.Slice:
+		alloc, ok := value.X.(*ssa.Alloc)
+		if !ok || alloc.Referrers() == nil {
+			return nil
+		}
+		funcs := []*ssa.Function{}
+		for _, ref := range *alloc.Referrers() {
+			indexAddr, ok := ref.(*ssa.IndexAddr)
+			if !ok || indexAddr.Referrers() == nil {
+				continue
+			}
+			for _, indexRef := range *indexAddr.Referrers() {
+				if store, ok := indexRef.(*ssa.Store); ok && store.Addr == indexAddr {
+					funcs = append(funcs, a.interceptorFuncs(store.Val, depth+1)...)
+				}
+			}
+		}
+		return funcs
+	case *ssa.Call:
+		callee := value.Common().StaticCallee()
+		if callee == nil {
+			return nil
+		}
+		funcs := []*ssa.Function{}
+		for _, block := range callee.Blocks {
+			for _, instr := range block.Instrs {
+				ret, ok := instr.(*ssa.Return)
+				if !ok || len(ret.Results) != 1 {
+					continue
+				}
+				funcs = append(funcs, a.interceptorFuncs(ret.Results[0], depth+1)...)
+			}
+		}
+		return funcs
+	}
+	return nil
+}
+
+// optionServers returns the grpc.NewServer calls given the server option v.
+// The option is followed through the slices of options, append and the functions taking or returning them.
+func (a *Analyzer) optionServers(cg *callgraph.Graph, v ssa.Value, depth int) []*ssa.Call {
+	if depth > maxResolveDepth || v.Referrers() == nil {
+		return nil
+	}
+	servers := []*ssa.Call{}
+	for _, ref := range *v.Referrers() {
+		switch instr := ref.(type) {
+		case *ssa.Store:
+			// the element of the slice literal or the variadic arguments.
+			indexAddr, ok := instr.Addr.(*ssa.IndexAddr)
+			if !ok || instr.Val != v {
+				continue
+			}
+			servers = append(servers, a.optionServers(cg, indexAddr.X, depth+1)...)
+		case *ssa.Slice:
+			servers = append(servers, a.optionServers(cg, instr, depth+1)...)
+		case *ssa.Phi:
+			servers = append(servers, a.optionServers(cg, instr, depth+1)...)
+		case *ssa.Call:
+			common := instr.Common()
+			if builtin, ok := common.Value.(*ssa.Builtin); ok {
+				if builtin.Name() == "append" {
+					servers = append(servers, a.optionServers(cg, instr, depth+1)...)
+				}
+				continue
+			}
+			callee := common.StaticCallee()
+			if callee == nil {
+				continue
+			}
+			if callee.Pkg != nil && callee.Pkg.Pkg.Path() == grpcPkgPath && callee.Name() == "NewServer" {
+				servers = append(servers, instr)
+				continue
+			}
+			for idx, arg := range common.Args {
+				if arg == v && idx < len(callee.Params) {
+					servers = append(servers, a.optionServers(cg, callee.Params[idx], depth+1)...)
+				}
+			}
+		case *ssa.Return:
+			if len(instr.Results) != 1 {
+				continue
+			}
+			node, exists := cg.Nodes[instr.Parent()]
+			if !exists {
+				continue
+			}
+			for _, edge := range node.In {
+				if edge.Site == nil || edge.Site.Value() == nil {
+					continue
+				}
+				servers = append(servers, a.optionServers(cg, edge.Site.Value(), depth+1)...)
+			}
+		}
+	}
+	return servers
+}
+
+// serverValues returns the grpc.NewServer calls which create the server v.
+func serverValues(v ssa.Value, depth int) []*ssa.Call {
+	if depth > maxResolveDepth {
+		return nil
+	}
+	switch value := v.(type) {
+	case *ssa.Call:
+		callee := value.Common().StaticCallee()
+		if callee != nil && callee.Pkg != nil && callee.Pkg.Pkg.Path() == grpcPkgPath && callee.Name() == "NewServer" {
+			return []*ssa.Call{value}
+		}
+	case *ssa.MakeInterface:
+		return serverValues(value.X, depth+1)
+	case *ssa.ChangeType:
+		return serverValues(value.X, depth+1)
+	case *ssa.Phi:
+		servers := []*ssa.Call{}
+		for _, edge := range value.Edges {
+			servers = append(servers, serverValues(edge, depth+1)...)
+		}
+		return servers
+	}
+	return nil
+}
+
+// registrations finds the implementations registered to the servers by the generated Register<Service>Server.
+func (a *Analyzer) registrations(cg *callgraph.Graph) ([]*registration, error) {
+	registrations := []*registration{}
+	if err := callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
+		if edge.Site == nil || edge.Callee.Func.Signature.Recv() != nil {
+			return nil
+		}
+		matched := registerServerPattern.FindStringSubmatch(edge.Callee.Func.Name())
+		if matched == nil {
+			return nil
+		}
+		args := edge.Site.Common().Args
+		if len(args) != 2 {
+			return nil
+		}
+		impl, ok := args[1].(*ssa.MakeInterface)
+		if !ok {
+			return nil
+		}
+		registrations = append(registrations, &registration{
+			service: matched[1],
+			impl:    impl.X.Type(),
+			servers: serverValues(args[0], 0),
+		})
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to walk edges: %w", err)
+	}
+	return registrations, nil
+}
+
+// handlerServers returns the grpc.NewServer calls serving the handler nodes of mtd.
+func (a *Analyzer) handlerServers(registrations []*registration, mtd *Method, nodes []*callgraph.Node) []*ssa.Call {
+	servers := []*ssa.Call{}
+	for _, r := range registrations {
+		if r.service != mtd.ProtoService {
+			continue
+		}
+		for _, node := range nodes {
+			recv := node.Func.Signature.Recv()
+			if recv == nil {
+				continue
+			}
+			if types.Identical(r.impl, recv.Type()) || types.Identical(r.impl, types.NewPointer(recv.Type())) {
+				servers = append(servers, r.servers...)
+				break
+			}
+		}
+	}
+	return servers
+}
+
+// sharesServer reports whether the interceptor is given to the server serving the handler.
+// It's true if either servers is unknown.
+func sharesServer(interceptorServers, handlerServers []*ssa.Call) bool {
+	if len(interceptorServers) == 0 || len(handlerServers) == 0 {
+		return true
+	}
+	for _, server := range interceptorServers {
+		for _, s := range handlerServers {
+			if server == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sharesBinary reports whether the interceptor may run with the method in the same binary.
+// It's true if either binaries is unknown.
+func sharesBinary(interceptorBinaries, methodBinaries []string) bool {
+	if len(interceptorBinaries) == 0 || len(methodBinaries) == 0 {
+		return true
+	}
+	for _, binary := range interceptorBinaries {
+		if containsString(methodBinaries, binary) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContinuation reports whether the edge calls the handler or the invoker given to the interceptor.
+func isContinuation(edge *callgraph.Edge) bool {
+	if edge.Site == nil {
+		return false
+	}
+	param, ok := edge.Site.Common().Value.(*ssa.Parameter)
+	if !ok {
+		return false
+	}
+	_, exists := continuationTypes[param.Type().String()]
+	return exists
+}
+
+// attributeInterceptors adds the dependencies of the interceptors to the analyzed methods.
+// Server interceptors run on every gRPC method served by the server given them, and client interceptors run on every method calling other gRPC methods.
+// servers maps the handlers to the servers serving them.
+func (a *Analyzer) attributeInterceptors(ctx *DetectContext, interceptors []*interceptor, edgeMap map[int][]*callgraph.Edge, handlers []*AnalyzedMethod, others []*AnalyzedMethod, servers map[*AnalyzedMethod][]*ssa.Call) error {
+	for _, i := range interceptors {
+		analyzed, err := a.analyzeRoot(ctx, i.roots, edgeMap, isContinuation)
+		if err != nil {
+			return xerrors.Errorf("failed to analyze interceptor %s: %w", i.name, err)
+		}
+		targets := []*AnalyzedMethod{}
+		if i.client {
+			for _, analyzedMethod := range append(append([]*AnalyzedMethod{}, handlers...), others...) {
+				if analyzedMethod.callsGRPC() {
+					targets = append(targets, analyzedMethod)
+				}
+			}
+		} else {
+			for _, handler := range handlers {
+				if sharesServer(i.servers, servers[handler]) {
+					targets = append(targets, handler)
+				}
+			}
+		}
+		for _, dep := range analyzed.Dependencies {
+			dep.Interceptor = i.name
+			for _, target := range targets {
+				if target.Dependency(dep.Method) != nil {
+					continue
+				}
+				if !sharesBinary(i.binaries, target.Binaries) {
+					continue
+				}
+				copied := *dep
+				target.Methods = append(target.Methods, copied.Method)
+				target.Dependencies = append(target.Dependencies, &copied)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package servicetracer
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	adminProto = `package admin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type PurgeRequest struct{}
+type PurgeResponse struct{}
+
+type AdminServiceServer interface {
+	Purge(context.Context, *PurgeRequest) (*PurgeResponse, error)
+}
+
+func RegisterAdminServiceServer(s grpc.ServiceRegistrar, srv AdminServiceServer) {
+	s.RegisterService(&AdminService_ServiceDesc, srv)
+}
+
+func _AdminService_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(AdminServiceServer).Purge(ctx, in)
+}
+
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Purge", Handler: _AdminService_Purge_Handler},
+	},
+}
+`
+	interceptorServer = `package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/example/proto/admin"
+	"github.com/example/proto/order"
+	"github.com/example/proto/user"
+	"google.golang.org/grpc"
+)
+
+type server struct{}
+
+func logRequest(ctx context.Context, req interface{}) {}
+
+func (s *server) GetOrder(ctx context.Context, req *order.GetOrderRequest) (*order.GetOrderResponse, error) {
+	logRequest(ctx, req)
+	return &order.GetOrderResponse{}, nil
+}
+
+type adminServer struct {
+	auditURL string
+}
+
+func (s *adminServer) Purge(ctx context.Context, req *admin.PurgeRequest) (*admin.PurgeResponse, error) {
+	logRequest(ctx, req)
+	return &admin.PurgeResponse{}, nil
+}
+
+// audit is given to the admin server as the method value.
+func (s *adminServer) audit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	http.Get("https://audit.example.com/v1/logs")
+	return handler(ctx, req)
+}
+
+func authInterceptor(client user.UserServiceClient) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, err := client.GetUser(ctx, &user.GetUserRequest{}); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func publicOptions(client user.UserServiceClient) []grpc.ServerOption {
+	opts := []grpc.ServerOption{}
+	opts = append(opts, grpc.UnaryInterceptor(authInterceptor(client)))
+	return opts
+}
+
+func main() {
+	conn, _ := grpc.Dial("user:443")
+	public := grpc.NewServer(publicOptions(user.NewUserServiceClient(conn))...)
+	order.RegisterOrderServiceServer(public, &server{})
+	a := &adminServer{}
+	private := grpc.NewServer(grpc.ChainUnaryInterceptor(a.audit))
+	admin.RegisterAdminServiceServer(private, a)
+	go public.Serve()
+	private.Serve()
+}
+`
+)
+
+func TestAttributeInterceptors(t *testing.T) {
+	cfg := orderFixtureConfig()
+	cfg.Services[0].mtds = append(cfg.Services[0].mtds, &Method{
+		GeneratedPath: "github.com/example/proto/admin",
+		Service:       "order",
+		Name:          "Purge",
+		InputType:     "PurgeRequest",
+		OutputType:    "PurgeResponse",
+		ProtoService:  "AdminService",
+	})
+	methodMap := analyzeFixture(t, cfg, map[string]string{
+		"github.com/example/proto/admin": adminProto,
+		"github.com/example/proto/order": orderProto,
+		"github.com/example/proto/user":  userProto,
+		fixtureRepo + "/cmd/server":      interceptorServer,
+	})
+	tests := []struct {
+		key          string
+		dependencies []string
+		interceptor  string
+	}{
+		{
+			key:          "order.getorder.getorderrequest.getorderresponse",
+			dependencies: []string{"user.GetUser"},
+			interceptor:  "authInterceptor$1",
+		},
+		{
+			key:          "order.purge.purgerequest.purgeresponse",
+			dependencies: []string{"audit.example.com GET /v1/logs"},
+			interceptor:  "(*adminServer).audit",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			analyzedMethod, exists := methodMap[test.key]
+			if !exists {
+				t.Fatalf("%s is not analyzed", test.key)
+			}
+			if diff := cmpStrings(test.dependencies, dependencyNames(analyzedMethod)); diff != "" {
+				t.Fatalf("unexpected dependencies: %s", diff)
+			}
+			if interceptor := analyzedMethod.Dependencies[0].Interceptor; !strings.HasSuffix(interceptor, test.interceptor) {
+				t.Errorf("expected interceptor %s but got %s", test.interceptor, interceptor)
+			}
+		})
+	}
+}
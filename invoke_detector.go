@@ -0,0 +1,164 @@
+package servicetracer
+
+import (
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/xerrors"
+)
+
+const (
+	unknownService = "unknown"
+)
+
+var (
+	// invokeFuncs maps the functions of grpc invoking RPCs dynamically to the index of the method argument ( excluding the receiver ).
+	invokeFuncs = map[string]int{
+		"(*ClientConn).Invoke":    1,
+		"(*ClientConn).NewStream": 2,
+		"Invoke":                  1,
+		"NewClientStream":         3,
+	}
+)
+
+// InvokeDetector detects RPCs invoked by ClientConn.Invoke or NewStream with the method like "/pkg.Service/Method"
+// instead of the generated client stubs ( e.g. generic proxies and retry helpers ).
+// The method is resolved through the parameters of the helpers on the call path from the handler,
+// and mapped to the method parsed from proto. Otherwise, it's reported as the unknown target.
+type InvokeDetector struct{}
+
+func (d *InvokeDetector) Name() string {
+	return "grpc-invoke"
+}
+
+func (d *InvokeDetector) Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	if edge.Site == nil || nodeToPkgPath(edge.Callee) != grpcPkgPath {
+		return nil, nil
+	}
+	idx, exists := invokeFuncs[relFuncName(edge.Callee.Func)]
+	if !exists {
+		return nil, nil
+	}
+	callerPkgPath := nodeToPkgPath(edge.Caller)
+	if strings.HasPrefix(callerPkgPath, grpcPkgPath) {
+		return nil, nil
+	}
+	generated, err := d.isGeneratedPath(ctx.Config, callerPkgPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to find generated path: %w", err)
+	}
+	if generated {
+		// the client stub is detected by GRPCDetector.
+		return nil, nil
+	}
+	args := callArgs(edge.Site, edge.Callee.Func)
+	if len(args) <= idx {
+		return nil, nil
+	}
+	mtds := []*Method{}
+	for _, name := range d.resolveMethodNames(args[idx], ctx.Path, 0) {
+		mtd, err := d.findMethod(ctx.Config, name)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to find method: %w", err)
+		}
+		mtds = append(mtds, mtd)
+	}
+	return mtds, nil
+}
+
+func (d *InvokeDetector) isGeneratedPath(cfg *Config, pkgPath string) (bool, error) {
+	for _, service := range cfg.Services {
+		mtds, err := service.Methods()
+		if err != nil {
+			return false, xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			if mtd.GeneratedPath == pkgPath {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// resolveMethodNames resolves v into the method names.
+// If v is the parameter of the caller, the argument passed to it on path is resolved instead.
+func (d *InvokeDetector) resolveMethodNames(v ssa.Value, path []*callgraph.Edge, depth int) []string {
+	if depth > maxResolveDepth {
+		return []string{unresolvedPart}
+	}
+	switch value := v.(type) {
+	case *ssa.Phi:
+		names := []string{}
+		for _, edge := range value.Edges {
+			for _, name := range d.resolveMethodNames(edge, path, depth+1) {
+				if !containsString(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+		return names
+	case *ssa.Parameter:
+		if len(path) == 0 {
+			return []string{unresolvedPart}
+		}
+		edge := path[len(path)-1]
+		if edge.Site == nil || edge.Callee.Func != value.Parent() {
+			return []string{unresolvedPart}
+		}
+		idx := -1
+		for i, param := range value.Parent().Params {
+			if param == value {
+				idx = i
+			}
+		}
+		common := edge.Site.Common()
+		if common.IsInvoke() {
+			// the receiver isn't included in the arguments of the interface method call.
+			idx--
+		}
+		if idx < 0 || idx >= len(common.Args) {
+			return []string{unresolvedPart}
+		}
+		return d.resolveMethodNames(common.Args[idx], path[:len(path)-1], depth+1)
+	}
+	name, _ := resolveString(v)
+	return []string{name}
+}
+
+// findMethod finds the method parsed from proto by the name like "/pkg.Service/Method".
+func (d *InvokeDetector) findMethod(cfg *Config, name string) (*Method, error) {
+	unknown := &Method{
+		Kind:    UnknownMethodKind,
+		Service: unknownService,
+		Name:    name,
+	}
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if len(parts) != 2 {
+		return unknown, nil
+	}
+	protoService, methodName := parts[0], parts[1]
+	for _, service := range cfg.Services {
+		mtds, err := service.Methods()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			if mtd.Name == methodName && mtd.ProtoServiceFullName() == protoService {
+				found := *mtd
+				return &found, nil
+			}
+		}
+	}
+	return unknown, nil
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package servicetracer
+
+import (
+	"testing"
+)
+
+var invokeServer = `package main
+
+import (
+	"context"
+
+	"github.com/example/proto/order"
+	"google.golang.org/grpc"
+)
+
+type server struct {
+	conn   *grpc.ClientConn
+	method string
+}
+
+func (s *server) GetOrder(ctx context.Context, req *order.GetOrderRequest) (*order.GetOrderResponse, error) {
+	if err := s.proxy(ctx, "/user.UserService/GetUser", req); err != nil {
+		return nil, err
+	}
+	if err := s.conn.Invoke(ctx, s.method, req, nil); err != nil {
+		return nil, err
+	}
+	return &order.GetOrderResponse{}, nil
+}
+
+// proxy invokes the method given by the caller.
+func (s *server) proxy(ctx context.Context, method string, req interface{}) error {
+	return s.conn.Invoke(ctx, method, req, nil)
+}
+
+func main() {
+	conn, _ := grpc.Dial("user:443")
+	s := grpc.NewServer()
+	order.RegisterOrderServiceServer(s, &server{conn: conn})
+	s.Serve()
+}
+`
+
+func TestInvokeDetector(t *testing.T) {
+	cfg := orderFixtureConfig()
+	for _, service := range cfg.Services {
+		for _, mtd := range service.mtds {
+			mtd.Pkg = service.Name
+		}
+	}
+	methodMap := analyzeFixture(t, cfg, map[string]string{
+		"github.com/example/proto/order": orderProto,
+		"github.com/example/proto/user":  userProto,
+		fixtureRepo + "/cmd/server":      invokeServer,
+	})
+	analyzedMethod, exists := methodMap["order.getorder.getorderrequest.getorderresponse"]
+	if !exists {
+		t.Fatalf("GetOrder is not analyzed: %v", methodMap)
+	}
+	// the method resolved through the parameter of the helper is mapped to the method parsed from proto,
+	// and the method given by the field is reported as the unknown target.
+	expected := []string{"unknown *", "user.GetUser"}
+	if diff := cmpStrings(expected, dependencyNames(analyzedMethod)); diff != "" {
+		t.Errorf("unexpected dependencies: %s", diff)
+	}
+}
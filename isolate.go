@@ -0,0 +1,188 @@
+package servicetracer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// isolatedServiceEnv and isolatedOutputEnv are given to the child process analyzing the service in isolation.
+	isolatedServiceEnv  = "SERVICE_TRACER_ISOLATED_SERVICE"
+	isolatedOutputEnv   = "SERVICE_TRACER_ISOLATED_OUTPUT"
+	memoryLimitExitCode = 3
+	memoryWatchInterval = 500 * time.Millisecond
+)
+
+var (
+	byteUnits = []struct {
+		suffix string
+		size   uint64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+)
+
+// parseBytes parses the size like "512MiB" or "8G" into bytes.
+func parseBytes(s string) (uint64, error) {
+	unit := uint64(1)
+	num := s
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			unit = u.size
+			num = strings.TrimSuffix(s, u.suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n < 0 {
+		return 0, xerrors.Errorf("invalid size %s", s)
+	}
+	return uint64(n * float64(unit)), nil
+}
+
+// isolatedAnalysis returns the name of the service and the output path if this process is the child of the isolated analysis.
+func isolatedAnalysis() (string, string, bool) {
+	name := os.Getenv(isolatedServiceEnv)
+	if name == "" {
+		return "", "", false
+	}
+	return name, os.Getenv(isolatedOutputEnv), true
+}
+
+// analyzeInChild analyzes the service in the child process running the same binary with the same arguments,
+// so the child has the same config and detectors. The child writes the method map to the temporary file in the cache format.
+// This assumes that the binary calls Run ( or Explain ) with os.Args, so the binary handling the arguments differently
+// ( e.g. the config given by other than the arguments ) fails to analyze the service in isolation.
+// If the child crashes or exceeds the memory limit, *AnalysisFailure is returned.
+func (t *ServiceTracer) analyzeInChild(ctx context.Context, service *Service) (MethodMap, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get executable: %w", err)
+	}
+	limit, err := service.AnalysisMemoryLimit(t.cfg.MemoryLimit)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get memory limit: %w", err)
+	}
+	output, err := ioutil.TempFile("", "service-tracer-*.yaml")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create output file: %w", err)
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", isolatedServiceEnv, service.Name),
+		fmt.Sprintf("%s=%s", isolatedOutputEnv, output.Name()),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if !xerrors.As(err, &exitErr) {
+			return nil, xerrors.Errorf("failed to run child process: %w", err)
+		}
+		return nil, &AnalysisFailure{
+			Service: service.Name,
+			Reason:  childFailureReason(exitErr.ProcessState, limit, stderr.String()),
+		}
+	}
+	if info, err := os.Stat(output.Name()); err != nil || info.Size() == 0 {
+		return nil, xerrors.Errorf("failed to get method map of child process: the binary must call Run with the same arguments to analyze the service in isolation")
+	}
+	methodMap, compatible, err := t.loadMethodMap(service, output.Name())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load method map of child process: %w", err)
+	}
+	if !compatible {
+		return nil, xerrors.Errorf("failed to load incompatible method map of child process")
+	}
+	return methodMap, nil
+}
+
+func childFailureReason(state *os.ProcessState, limit uint64, stderr string) string {
+	if state.ExitCode() == memoryLimitExitCode && limit > 0 {
+		return fmt.Sprintf("exceeded memory limit %s", formatBytes(limit))
+	}
+	if state.ExitCode() < 0 {
+		return fmt.Sprintf("%s ( possibly killed by the OOM killer )", state)
+	}
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			return fmt.Sprintf("crashed: %s", line)
+		}
+	}
+	return fmt.Sprintf("crashed: %s", state)
+}
+
+// runIsolated analyzes the service in the child process and writes the method map to output.
+func (t *ServiceTracer) runIsolated(ctx context.Context, name, output string) error {
+	service := t.cfg.ServiceByName(name)
+	if service == nil {
+		return xerrors.Errorf("failed to find service %s", name)
+	}
+	limit, err := service.AnalysisMemoryLimit(t.cfg.MemoryLimit)
+	if err != nil {
+		return xerrors.Errorf("failed to get memory limit: %w", err)
+	}
+	if limit > 0 {
+		stop := watchMemory(limit)
+		defer stop()
+	}
+	methodMap, err := t.analyzer.AnalyzeContext(ctx, service)
+	if err != nil {
+		return xerrors.Errorf("failed to analyze: %w", err)
+	}
+	if err := writeMethodMapCache(output, service, methodMap); err != nil {
+		return xerrors.Errorf("failed to write method map: %w", err)
+	}
+	return nil
+}
+
+// watchMemory exits the process with memoryLimitExitCode when the memory of the process exceeds limit.
+// It returns the function to stop watching.
+func watchMemory(limit uint64) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(memoryWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if used := processMemory(); used > limit {
+				fmt.Fprintf(os.Stderr, "memory %s exceeded limit %s\n", formatBytes(used), formatBytes(limit))
+				os.Exit(memoryLimitExitCode)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// processMemory returns the memory obtained from the OS by the runtime and not released yet.
+// It includes the stacks and the metadata of the heap in addition to the live objects,
+// so it's closer to the memory the OOM killer sees than HeapAlloc.
+func processMemory() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys - stats.HeapReleased
+}
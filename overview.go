@@ -0,0 +1,189 @@
+package servicetracer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/goccy/go-graphviz"
+	"github.com/goccy/go-graphviz/cgraph"
+	"golang.org/x/xerrors"
+)
+
+const (
+	maxOverviewPenWidth = 6
+)
+
+// serviceDependency is the dependency between services aggregated from the method dependencies.
+type serviceDependency struct {
+	From string
+	To   string
+	// Async is true if all dependencies are publishing to the topics consumed by To.
+	Async bool
+	// Methods are the distinct method dependencies like "serviceA.GetA -> serviceB.GetB".
+	Methods []string
+}
+
+// Weight is the number of the distinct method dependencies.
+func (d *serviceDependency) Weight() int {
+	return len(d.Methods)
+}
+
+// serviceDependencies aggregates the method dependencies of methodMap to the dependencies between services.
+// The calls within the service are ignored.
+func (r *Renderer) serviceDependencies(methodMap MethodMap) ([]*serviceDependency, error) {
+	depMap := map[string]*serviceDependency{}
+	methodsMap := map[string]map[string]struct{}{}
+	add := func(from, to string, async bool, method string) {
+		key := fmt.Sprintf("%s:%s", from, to)
+		dep, exists := depMap[key]
+		if !exists {
+			dep = &serviceDependency{From: from, To: to, Async: true}
+			depMap[key] = dep
+			methodsMap[key] = map[string]struct{}{}
+		}
+		if _, exists := methodsMap[key][method]; exists {
+			return
+		}
+		dep.Async = dep.Async && async
+		methodsMap[key][method] = struct{}{}
+		dep.Methods = append(dep.Methods, method)
+	}
+	for _, service := range r.cfg.Services {
+		mtds, err := r.serviceMethods(service, methodMap)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get methods: %w", err)
+		}
+		for _, mtd := range mtds {
+			analyzedMethod, exists := methodMap[mtd.MangledName()]
+			if !exists {
+				continue
+			}
+			fromName := fmt.Sprintf("%s.%s", service.Name, mtd.Name)
+			for _, dep := range analyzedMethod.Dependencies {
+				switch {
+				case dep.Method.IsGRPC():
+					if dep.Method.Service == service.Name {
+						continue
+					}
+					add(service.Name, dep.Method.Service, false, fmt.Sprintf("%s -> %s.%s", fromName, dep.Method.Service, dep.Method.Name))
+				case dep.Method.Kind == TopicMethodKind:
+					for _, name := range sortedMethodNames(methodMap) {
+						consumer := methodMap[name]
+						if consumer.Entry == nil || consumer.Entry.Service == service.Name || !consumer.Subscribes(dep.Method) {
+							continue
+						}
+						add(service.Name, consumer.Entry.Service, true, fmt.Sprintf("%s -> %s.%s ( %s )", fromName, consumer.Entry.Service, consumer.Entry.Name, dep.Method.Name))
+					}
+				}
+			}
+		}
+	}
+	deps := make([]*serviceDependency, 0, len(depMap))
+	for _, dep := range depMap {
+		sort.Strings(dep.Methods)
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].From != deps[j].From {
+			return deps[i].From < deps[j].From
+		}
+		return deps[i].To < deps[j].To
+	})
+	return deps, nil
+}
+
+// renderOverviewGraph renders the services as nodes and the dependencies between them as edges labeled with the weight.
+// The services are clustered by the domain, and clicking the service shows the graphs of its methods.
+func (r *Renderer) renderOverviewGraph(methodMap MethodMap, failures []*AnalysisFailure) (string, error) {
+	deps, err := r.serviceDependencies(methodMap)
+	if err != nil {
+		return "", xerrors.Errorf("failed to aggregate service dependencies: %w", err)
+	}
+	g := graphviz.New()
+	graph, err := g.Graph()
+	if err != nil {
+		return "", xerrors.Errorf("failed to create graphviz graph: %w", err)
+	}
+	defer func() {
+		if err := graph.Close(); err != nil {
+			log.Fatalf("failed to close graphviz graph %s", err)
+		}
+		g.Close()
+	}()
+	graph.SetRankDir(cgraph.LRRank)
+	graph.SetNewRank(true)
+
+	domains := map[string]*cgraph.Graph{}
+	nodes := map[string]*cgraph.Node{}
+	for _, service := range r.cfg.Services {
+		parent := graph
+		if service.Domain != "" {
+			subgraph, exists := domains[service.Domain]
+			if !exists {
+				subgraph = r.uniqueSubgraph(graph)
+				subgraph.SetLabel(service.Domain)
+				domains[service.Domain] = subgraph
+			}
+			parent = subgraph
+		}
+		node, err := r.uniqueNode(parent, service.Name)
+		if err != nil {
+			return "", xerrors.Errorf("failed to create unique node: %w", err)
+		}
+		node.SetURL(selectServiceURL(service.Name))
+		node.SetTooltip(fmt.Sprintf("show methods of %s", service.Name))
+		for _, failure := range failures {
+			if failure.Service == service.Name {
+				node.SetColor("#dc3545")
+				node.SetTooltip(fmt.Sprintf("analysis failed: %s", failure.Reason))
+			}
+		}
+		nodes[service.Name] = node
+	}
+	for _, dep := range deps {
+		from := nodes[dep.From]
+		to, exists := nodes[dep.To]
+		if !exists {
+			// the service called by the generated client isn't in the config.
+			node, err := r.uniqueNode(graph, dep.To)
+			if err != nil {
+				return "", xerrors.Errorf("failed to create unique node: %w", err)
+			}
+			node.SetColor("#c9c9c9")
+			nodes[dep.To] = node
+			to = node
+		}
+		edge, err := r.uniqueEdge(graph, from, to)
+		if err != nil {
+			return "", xerrors.Errorf("failed to create unique edge: %w", err)
+		}
+		weight := dep.Weight()
+		edge.SetLabel(fmt.Sprint(weight))
+		edge.SetWeight(float64(weight))
+		penWidth := weight
+		if penWidth > maxOverviewPenWidth {
+			penWidth = maxOverviewPenWidth
+		}
+		edge.SetPenWidth(float64(penWidth))
+		edge.SetTooltip(strings.Join(dep.Methods, ", "))
+		edge.SetLabelTooltip(strings.Join(dep.Methods, ", "))
+		edge.SetURL(selectServiceURL(dep.From))
+		if dep.Async {
+			edge.SetStyle(cgraph.DashedEdgeStyle)
+		}
+	}
+	var b bytes.Buffer
+	g.Render(graph, graphviz.SVG, &b)
+	return b.String(), nil
+}
+
+// selectServiceURL returns the URL showing the graphs of the service.
+// The name is escaped as JavaScript string, and then percent-encoded because the browser decodes javascript: URL.
+func selectServiceURL(name string) string {
+	return fmt.Sprintf("javascript:selectService('%s')", url.PathEscape(template.JSEscapeString(name)))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"golang.org/x/xerrors"
 )
@@ -17,6 +18,16 @@ func SubPath(service *Service, file string) string {
 	return file[len(rootPath):]
 }
 
+// RelativePath returns file relative to the repository root of service.
+// Files outside of the repository ( e.g. dependent modules ) are returned as is.
+func RelativePath(service *Service, file string) string {
+	rootPath, _ := filepath.Abs(RepoRoot(service))
+	if !strings.HasPrefix(file, rootPath+string(filepath.Separator)) {
+		return file
+	}
+	return filepath.ToSlash(file[len(rootPath)+1:])
+}
+
 func FileURL(service *Service, file string) string {
 	return fmt.Sprintf("https://%s/blob/master%s", service.Repo, SubPath(service, file))
 }
@@ -30,6 +41,9 @@ func ServiceMapFile(service *Service) string {
 }
 
 func RepoRoot(service *Service) string {
+	if service.repoDir != "" {
+		return service.repoDir
+	}
 	return filepath.Join(cacheDir, service.RepoName())
 }
 
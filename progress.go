@@ -0,0 +1,163 @@
+package servicetracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Stage is the step of tracing reported to ProgressReporter.
+type Stage string
+
+const (
+	CloneStage     Stage = "clone"
+	LoadStage      Stage = "load"
+	BuildStage     Stage = "ssa"
+	CallGraphStage Stage = "callgraph"
+	TraverseStage  Stage = "traverse"
+	// AnalyzeStage is the whole analysis of the service including load, ssa, callgraph and traverse stages.
+	AnalyzeStage Stage = "analyze"
+	RenderStage  Stage = "render"
+)
+
+// ProgressEvent is reported when the stage starts and finishes.
+// Elapsed and HeapAlloc are set when the stage finishes.
+// HeapAlloc is the heap memory in use at the end of the stage, or the peak of the stages for AnalyzeStage.
+type ProgressEvent struct {
+	Service   string
+	Stage     Stage
+	Done      bool
+	Elapsed   time.Duration
+	HeapAlloc uint64
+	Err       error
+}
+
+// ProgressReporter receives the progress of tracing.
+type ProgressReporter interface {
+	Report(ev *ProgressEvent)
+}
+
+// TextProgressReporter writes the progress in human readable form.
+type TextProgressReporter struct {
+	w io.Writer
+}
+
+func NewTextProgressReporter(w io.Writer) *TextProgressReporter {
+	return &TextProgressReporter{w: w}
+}
+
+func (r *TextProgressReporter) Report(ev *ProgressEvent) {
+	name := string(ev.Stage)
+	if ev.Service != "" {
+		name = fmt.Sprintf("%s: %s", ev.Service, ev.Stage)
+	}
+	switch {
+	case !ev.Done:
+		fmt.Fprintf(r.w, "%s...\n", name)
+	case ev.Err != nil:
+		fmt.Fprintf(r.w, "%s failed after %s: %s\n", name, ev.Elapsed.Round(time.Millisecond), ev.Err)
+	default:
+		fmt.Fprintf(r.w, "%s done in %s ( heap %s )\n", name, ev.Elapsed.Round(time.Millisecond), formatBytes(ev.HeapAlloc))
+	}
+}
+
+// JSONProgressReporter writes each progress event as a line of JSON.
+type JSONProgressReporter struct {
+	enc *json.Encoder
+}
+
+func NewJSONProgressReporter(w io.Writer) *JSONProgressReporter {
+	return &JSONProgressReporter{enc: json.NewEncoder(w)}
+}
+
+type jsonProgressEvent struct {
+	Service   string `json:"service,omitempty"`
+	Stage     Stage  `json:"stage"`
+	Done      bool   `json:"done"`
+	ElapsedMS int64  `json:"elapsed_ms,omitempty"`
+	HeapAlloc uint64 `json:"heap_alloc,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (r *JSONProgressReporter) Report(ev *ProgressEvent) {
+	v := &jsonProgressEvent{
+		Service:   ev.Service,
+		Stage:     ev.Stage,
+		Done:      ev.Done,
+		ElapsedMS: ev.Elapsed.Milliseconds(),
+		HeapAlloc: ev.HeapAlloc,
+	}
+	if ev.Err != nil {
+		v.Error = ev.Err.Error()
+	}
+	_ = r.enc.Encode(v)
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// progress measures the stages and reports them to the reporter.
+// Stages of the timed out analysis may be still reported from the other goroutine, so it's guarded by mutex.
+type progress struct {
+	mu       sync.Mutex
+	reporter ProgressReporter
+	peaks    map[string]uint64
+}
+
+func newProgress(reporter ProgressReporter) *progress {
+	return &progress{
+		reporter: reporter,
+		peaks:    map[string]uint64{},
+	}
+}
+
+// start reports the start of the stage and returns the function to report the end of it.
+func (p *progress) start(service string, stage Stage) func(error) {
+	p.report(&ProgressEvent{Service: service, Stage: stage})
+	if stage == AnalyzeStage {
+		p.mu.Lock()
+		p.peaks[service] = 0
+		p.mu.Unlock()
+	}
+	started := time.Now()
+	return func(err error) {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		p.mu.Lock()
+		heapAlloc := stats.HeapAlloc
+		if heapAlloc > p.peaks[service] {
+			p.peaks[service] = heapAlloc
+		}
+		if stage == AnalyzeStage {
+			heapAlloc = p.peaks[service]
+		}
+		p.mu.Unlock()
+		p.report(&ProgressEvent{
+			Service:   service,
+			Stage:     stage,
+			Done:      true,
+			Elapsed:   time.Since(started),
+			HeapAlloc: heapAlloc,
+			Err:       err,
+		})
+	}
+}
+
+func (p *progress) report(ev *ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reporter.Report(ev)
+}
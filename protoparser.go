@@ -48,6 +48,7 @@ func ParseProto(serviceName, path string) ([]*Method, error) {
 			for _, method := range service.Method {
 				mtds = append(mtds, &Method{
 					Pkg:           *result.Package,
+					ProtoService:  *service.Name,
 					GeneratedPath: generatedPath,
 					Service:       serviceName,
 					Name:          *method.Name,
@@ -6,17 +6,19 @@ import (
 	"image/color"
 	"io/ioutil"
 	"log"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/goccy/go-graphviz"
 	"github.com/goccy/go-graphviz/cgraph"
-	"github.com/rs/xid"
 	"golang.org/x/xerrors"
 )
 
 type Renderer struct {
 	cfg      *Config
 	colorIdx int
+	idIdx    int
 }
 
 func NewRenderer(cfg *Config) *Renderer {
@@ -69,14 +71,56 @@ func (r *Renderer) renderServiceGraph(service *Service, methodMap MethodMap) ([]
 		if err != nil {
 			return nil, xerrors.Errorf("failed to render method graph: %w", err)
 		}
-		graphs = append(graphs, &methodGraph{
-			Name:  mtd.Name,
-			Graph: graph,
-		})
+		graphs = append(graphs, graph)
+	}
+	for _, entry := range r.entries(service, methodMap) {
+		graph, err := r.renderMethodGraph(service, entry, methodMap)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to render method graph: %w", err)
+		}
+		graphs = append(graphs, graph)
 	}
 	return graphs, nil
 }
 
+// entries returns the entry points other than gRPC handlers of service.
+func (r *Renderer) entries(service *Service, methodMap MethodMap) []*Method {
+	entries := []*Method{}
+	for _, analyzedMethod := range methodMap {
+		if analyzedMethod.Entry == nil || analyzedMethod.Entry.Service != service.Name {
+			continue
+		}
+		entries = append(entries, analyzedMethod.Entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].MangledName() < entries[j].MangledName()
+	})
+	return entries
+}
+
+// callers returns the names of handlers and entry points depending on mtd.
+// It includes callers in caller-only services, so it shows who still calls mtd.
+func (r *Renderer) callers(mtd *Method, methodMap MethodMap) []string {
+	callers := []string{}
+	for _, service := range r.cfg.Services {
+		mtds, err := service.Methods()
+		if err != nil {
+			continue
+		}
+		froms := make([]*Method, 0, len(mtds))
+		froms = append(froms, mtds...)
+		for _, from := range append(froms, r.entries(service, methodMap)...) {
+			analyzedMethod, exists := methodMap[from.MangledName()]
+			if !exists || analyzedMethod.Dependency(mtd) == nil {
+				continue
+			}
+			callers = append(callers, fmt.Sprintf("%s.%s", service.Name, from.Name))
+		}
+	}
+	sort.Strings(callers)
+	return callers
+}
+
 func (r *Renderer) uniqueSubgraph(graph *cgraph.Graph) *cgraph.Graph {
 	return graph.SubGraph(fmt.Sprintf("cluster%s", r.generateID()), 1)
 }
@@ -100,11 +144,11 @@ func (r *Renderer) uniqueEdge(graph *cgraph.Graph, from *cgraph.Node, to *cgraph
 	return edge, nil
 }
 
-func (r *Renderer) renderMethodGraph(service *Service, mtd *Method, methodMap MethodMap) (string, error) {
+func (r *Renderer) renderMethodGraph(service *Service, mtd *Method, methodMap MethodMap) (*methodGraph, error) {
 	g := graphviz.New()
 	graph, err := g.Graph()
 	if err != nil {
-		return "", xerrors.Errorf("failed to create graphviz graph: %w", err)
+		return nil, xerrors.Errorf("failed to create graphviz graph: %w", err)
 	}
 	defer func() {
 		if err := graph.Close(); err != nil {
@@ -119,7 +163,7 @@ func (r *Renderer) renderMethodGraph(service *Service, mtd *Method, methodMap Me
 
 	from, err := r.uniqueNode(graph, mtdName)
 	if err != nil {
-		return "", xerrors.Errorf("failed to create unique node: %w", err)
+		return nil, xerrors.Errorf("failed to create unique node: %w", err)
 	}
 	analyzedMethod, exists := methodMap[mtd.MangledName()]
 	if exists {
@@ -127,36 +171,81 @@ func (r *Renderer) renderMethodGraph(service *Service, mtd *Method, methodMap Me
 	} else {
 		from.SetColor("#c9c9c9")
 	}
+	mg := &methodGraph{Name: mtd.Name, Callers: r.callers(mtd, methodMap)}
 	if analyzedMethod != nil && len(analyzedMethod.Methods) != 0 {
 		edgeMap := map[string]struct{}{}
-		if err := r.render(graph, service.Name, edgeMap, from, mtd, analyzedMethod, methodMap); err != nil {
-			return "", xerrors.Errorf("failed to render graph: %w", err)
+		if err := r.render(graph, service.Name, edgeMap, mg, from, mtd, analyzedMethod, methodMap); err != nil {
+			return nil, xerrors.Errorf("failed to render graph: %w", err)
 		}
 	}
 	var b bytes.Buffer
 	g.Render(graph, graphviz.SVG, &b)
-	return b.String(), nil
+	mg.Graph = b.String()
+	return mg, nil
 }
 
 type serviceGraph struct {
 	Name    string
 	Methods []*methodGraph
+	Failure string
 }
 
 type methodGraph struct {
-	Name  string
-	Graph string
+	Name      string
+	Graph     string
+	CallSites []*callSiteGroup
+	Callers   []string
+}
+
+type callSiteGroup struct {
+	Name   string
+	Labels string
+	Sites  []*CallSite
 }
 
 type renderParam struct {
+	Overview string
 	Services []*serviceGraph
 }
 
+// generateID returns the sequential ID, so the same method map is always rendered into the same output.
 func (r *Renderer) generateID() string {
-	return xid.New().String()
+	r.idIdx++
+	return fmt.Sprintf("id%d", r.idIdx)
 }
 
-func (r *Renderer) Render(methodMap MethodMap) error {
+// Render writes methodMap in the formats of the config. The failed services are rendered with the reason.
+func (r *Renderer) Render(methodMap MethodMap, failures ...*AnalysisFailure) error {
+	for _, format := range r.cfg.Formats {
+		switch format {
+		case HTMLFormat:
+			if err := r.renderHTML(methodMap, failures); err != nil {
+				return xerrors.Errorf("failed to render HTML: %w", err)
+			}
+		case JSONFormat:
+			if err := r.renderJSON(methodMap, failures); err != nil {
+				return xerrors.Errorf("failed to render JSON: %w", err)
+			}
+		case DOTFormat, MermaidFormat, PlantUMLFormat:
+			if err := r.renderDiagrams(format, methodMap); err != nil {
+				return xerrors.Errorf("failed to render %s: %w", format, err)
+			}
+		case SVGFormat, PNGFormat, PDFFormat:
+			if err := r.renderImages(format, methodMap); err != nil {
+				return xerrors.Errorf("failed to render %s: %w", format, err)
+			}
+		default:
+			return xerrors.Errorf("unknown format %s", format)
+		}
+	}
+	if err := r.renderIndex(r.cfg.Formats, methodMap); err != nil {
+		return xerrors.Errorf("failed to render index: %w", err)
+	}
+	return nil
+}
+
+// renderHTML writes the graphs of all methods to <output>.html .
+func (r *Renderer) renderHTML(methodMap MethodMap, failures []*AnalysisFailure) error {
 	tmpl, err := template.New("graph.tmpl").Parse(outputHTML)
 	if err != nil {
 		return xerrors.Errorf("failed to parse template HTML: %w", err)
@@ -167,13 +256,24 @@ func (r *Renderer) Render(methodMap MethodMap) error {
 		if err != nil {
 			return xerrors.Errorf("failed to render service graph: %w", err)
 		}
-		graphs = append(graphs, &serviceGraph{
+		graph := &serviceGraph{
 			Name:    service.Name,
 			Methods: mtds,
-		})
+		}
+		for _, failure := range failures {
+			if failure.Service == service.Name {
+				graph.Failure = failure.Reason
+			}
+		}
+		graphs = append(graphs, graph)
+	}
+	overview, err := r.renderOverviewGraph(methodMap, failures)
+	if err != nil {
+		return xerrors.Errorf("failed to render overview graph: %w", err)
 	}
 	var b bytes.Buffer
 	if err := tmpl.Execute(&b, renderParam{
+		Overview: overview,
 		Services: graphs,
 	}); err != nil {
 		return xerrors.Errorf("failed to execute template: %w", err)
@@ -188,6 +288,7 @@ func (r *Renderer) render(
 	graph *cgraph.Graph,
 	serviceName string,
 	edgeMap map[string]struct{},
+	mg *methodGraph,
 	fromNode *cgraph.Node,
 	from *Method,
 	analyzedMethod *AnalyzedMethod,
@@ -207,17 +308,34 @@ func (r *Renderer) render(
 			continue
 		}
 		edgeMap[edgeName] = struct{}{}
-		toNode, err := r.uniqueNode(graph, fmt.Sprintf("%s.%s", to.Service, to.Name))
+		toNode, err := r.uniqueNode(graph, to.DisplayName())
 		if err != nil {
 			return xerrors.Errorf("failed to create unique node: %w", err)
 		}
-		if _, err := r.uniqueEdge(graph, fromNode, toNode); err != nil {
+		r.setKind(toNode, to)
+		edge, err := r.uniqueEdge(graph, fromNode, toNode)
+		if err != nil {
 			return xerrors.Errorf("failed to create edge: %w", err)
 		}
+		if dep := analyzedMethod.Dependency(to); dep != nil {
+			r.setDependency(edge, dep)
+			if len(dep.CallSites) != 0 {
+				mg.CallSites = append(mg.CallSites, &callSiteGroup{
+					Name:   fmt.Sprintf("%s -> %s", fromName, to.DisplayName()),
+					Labels: strings.Join(dep.Labels(), ", "),
+					Sites:  dep.CallSites,
+				})
+			}
+		}
+		if to.Kind == TopicMethodKind {
+			if err := r.renderSubscribers(graph, serviceName, edgeMap, mg, toNode, to, methodMap); err != nil {
+				return xerrors.Errorf("failed to render subscribers: %w", err)
+			}
+		}
 		toMethods, exists := methodMap[to.MangledName()]
 		if exists {
 			toNode.SetURL(toMethods.SourceURL)
-			if err := r.render(graph, serviceName, edgeMap, toNode, to, toMethods, methodMap); err != nil {
+			if err := r.render(graph, serviceName, edgeMap, mg, toNode, to, toMethods, methodMap); err != nil {
 				return xerrors.Errorf("failed to render graph: %w", err)
 			}
 		}
@@ -225,6 +343,140 @@ func (r *Renderer) render(
 	return nil
 }
 
+// renderSubscribers renders the edges from the topic to the consumers and the dependencies of the consumers.
+func (r *Renderer) renderSubscribers(
+	graph *cgraph.Graph,
+	serviceName string,
+	edgeMap map[string]struct{},
+	mg *methodGraph,
+	topicNode *cgraph.Node,
+	topic *Method,
+	methodMap MethodMap) error {
+
+	names := make([]string, 0, len(methodMap))
+	for name := range methodMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		consumer := methodMap[name]
+		if consumer.Entry == nil || !consumer.Subscribes(topic) {
+			continue
+		}
+		edgeName := fmt.Sprintf("%s.%s", topic.MangledName(), name)
+		if _, exists := edgeMap[edgeName]; exists {
+			continue
+		}
+		edgeMap[edgeName] = struct{}{}
+		consumerNode, err := r.uniqueNode(graph, consumer.Entry.DisplayName())
+		if err != nil {
+			return xerrors.Errorf("failed to create unique node: %w", err)
+		}
+		consumerNode.SetURL(consumer.SourceURL)
+		edge, err := r.uniqueEdge(graph, topicNode, consumerNode)
+		if err != nil {
+			return xerrors.Errorf("failed to create edge: %w", err)
+		}
+		edge.SetStyle(cgraph.DottedEdgeStyle)
+		edge.SetLabel("subscribe")
+		if err := r.render(graph, serviceName, edgeMap, mg, consumerNode, consumer.Entry, consumer, methodMap); err != nil {
+			return xerrors.Errorf("failed to render graph: %w", err)
+		}
+	}
+	return nil
+}
+
+// setKind changes the shape of node by the kind of mtd.
+func (r *Renderer) setKind(node *cgraph.Node, mtd *Method) {
+	switch mtd.Kind {
+	case HTTPMethodKind:
+		node.SetLabel(methodLabel(mtd))
+		node.SetShape(cgraph.EllipseShape)
+	case TopicMethodKind:
+		node.SetLabel(methodLabel(mtd))
+		node.SetShape(cgraph.CdsShape)
+	case TableMethodKind:
+		node.SetLabel(methodLabel(mtd))
+		node.SetShape(cgraph.CylinderShape)
+	case UnknownMethodKind:
+		node.SetLabel(methodLabel(mtd))
+		node.SetShape(cgraph.OctagonShape)
+		node.SetStyle(cgraph.DashedNodeStyle)
+	}
+}
+
+// methodLabel returns the label of the node of mtd. Lines are separated by "\n".
+func methodLabel(mtd *Method) string {
+	switch mtd.Kind {
+	case HTTPMethodKind, TopicMethodKind:
+		return fmt.Sprintf("%s\n%s", mtd.Service, mtd.Name)
+	case TableMethodKind:
+		return mtd.Name
+	case UnknownMethodKind:
+		return fmt.Sprintf("unknown target\n%s", mtd.Name)
+	}
+	return mtd.DisplayName()
+}
+
+// setDependency decorates edge by the call properties of dep and links it to the call sites of the client stub.
+// Graphviz edge has only one URL, so the edge opens the first call site and the others are shown as tooltip.
+func (r *Renderer) setDependency(edge *cgraph.Edge, dep *Dependency) {
+	styles, labels := dependencyDecoration(dep)
+	if len(styles) != 0 {
+		edge.SetStyle(cgraph.EdgeStyle(strings.Join(styles, ",")))
+	}
+	if len(labels) != 0 {
+		edge.SetLabel(strings.Join(labels, ", "))
+	}
+	if len(dep.CallSites) == 0 {
+		return
+	}
+	locations := make([]string, 0, len(dep.CallSites))
+	for _, site := range dep.CallSites {
+		locations = append(locations, site.Location())
+	}
+	edge.SetTooltip(strings.Join(locations, "\n"))
+	for _, site := range dep.CallSites {
+		if site.URL != "" {
+			edge.SetURL(site.URL)
+			break
+		}
+	}
+}
+
+// dependencyDecoration returns the edge styles and the labels by the call properties of dep.
+func dependencyDecoration(dep *Dependency) ([]string, []string) {
+	styles := []string{}
+	labels := []string{}
+	if dep.Conditional {
+		styles = append(styles, string(cgraph.DashedEdgeStyle))
+		labels = append(labels, "if")
+	}
+	if dep.InLoop {
+		styles = append(styles, string(cgraph.BoldEdgeStyle))
+		labels = append(labels, "loop")
+	}
+	if dep.Async || dep.Method.Kind == TopicMethodKind {
+		styles = append(styles, string(cgraph.DottedEdgeStyle))
+	}
+	if dep.Async {
+		labels = append(labels, "async")
+	}
+	if dep.Method.Kind == TopicMethodKind {
+		labels = append(labels, "publish")
+	}
+	if dep.Method.Access != "" {
+		labels = append(labels, dep.Method.Access)
+	}
+	if dep.Interceptor != "" {
+		labels = append(labels, "interceptor")
+	}
+	if len(dep.CallSites) > 1 {
+		labels = append(labels, fmt.Sprintf("%d calls", len(dep.CallSites)))
+	}
+	return styles, labels
+}
+
 const outputHTML = `
 <html>
   <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/4.0.0-beta.3/css/bootstrap.min.css" integrity="sha384-Zug+QiDoJOrZ5t4lssLdxGhVrurbmBWopoEl+M6BdEfwnCJZtKxi1KgxUyJq13dy" crossorigin="anonymous">
@@ -242,6 +494,10 @@ const outputHTML = `
 h3 {
     margin: 20px;
 }
+
+.call-sites {
+    margin-left: 20px;
+}
   </style>
   <script type="text/javascript">
     function selectService(serviceName) {
@@ -249,19 +505,46 @@ h3 {
         document.getElementById("ref").innerHTML = serviceGraph;
         document.getElementById("title").innerHTML = serviceName + " method dependencies";
     };
+    function selectOverview() {
+        document.getElementById("ref").innerHTML = document.getElementById("overview").innerHTML;
+        document.getElementById("title").innerHTML = "service dependencies";
+    };
   </script>
   <body>
     <div class="row">
       <div id="list" class="col-3">
         <ul class="list-group">
+          <div id="overview" style="display:none">
+            {{ .Overview }}
+          </div>
+          <li class="list-group-item list-group-item-action" onClick="selectOverview()">overview</li>
           {{- range .Services }}
           <div id="{{ .Name }}" style="display:none">
+            {{- if .Failure }}
+            <p class="text-danger">analysis failed: {{ .Failure }}</p>
+            {{- end }}
             {{- range .Methods }}
             <h3>{{ .Name }}</h3>
             {{ .Graph }}
+            {{- if .Callers }}
+            <h6 class="call-sites">called by</h6>
+            <ul class="call-sites">
+              {{- range .Callers }}
+              <li>{{ . }}</li>
+              {{- end }}
+            </ul>
+            {{- end }}
+            {{- range .CallSites }}
+            <h6 class="call-sites">{{ .Name }} ({{ .Labels }})</h6>
+            <ul class="call-sites">
+              {{- range .Sites }}
+              <li>{{ if .URL }}<a href="{{ .URL }}" target="_blank">{{ .Location }}</a>{{ else }}{{ .Location }}{{ end }} {{ .Caller }}</li>
+              {{- end }}
+            </ul>
+            {{- end }}
             {{- end }}
           </div>
-          <li class="list-group-item list-group-item-action" onClick="selectService('{{ .Name }}')">{{ .Name }}</li>
+          <li class="list-group-item list-group-item-action" onClick="selectService('{{ .Name }}')">{{ .Name }}{{ if .Failure }} <span class="badge badge-danger">failed</span>{{ end }}</li>
           {{- end }}
         </ul>
       </div>
@@ -273,7 +556,6 @@ h3 {
       </div>
     </div>
   </body>
-  {{- $service := index .Services 0 }}
-  <script type="text/javascript">selectService("{{ $service.Name }}");</script>
+  <script type="text/javascript">selectOverview();</script>
 </html>
 `
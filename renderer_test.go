@@ -0,0 +1,47 @@
+package servicetracer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMethodGraphLinksCallSites(t *testing.T) {
+	cfg := orderFixtureConfig()
+	getOrder := cfg.Services[0].mtds[0]
+	getUser := cfg.Services[1].mtds[0]
+	sites := []*CallSite{
+		{Caller: "server.GetOrder", Callee: "user.GetUser", File: "server.go", Line: 16, URL: "https://github.com/example/svc/blob/master/server.go#L16"},
+		{Caller: "server.userName", Callee: "user.GetUser", File: "server.go", Line: 27, URL: "https://github.com/example/svc/blob/master/server.go#L27"},
+	}
+	methodMap := MethodMap{
+		getOrder.MangledName(): {
+			Methods: []*Method{getUser},
+			Dependencies: []*Dependency{
+				{Method: getUser, Path: sites[:1], CallSites: sites},
+			},
+		},
+	}
+	mg, err := NewRenderer(cfg).renderMethodGraph(cfg.Services[0], getOrder, methodMap)
+	if err != nil {
+		t.Fatalf("failed to render method graph: %+v", err)
+	}
+	if len(mg.CallSites) != 1 {
+		t.Fatalf("unexpected call site groups: %d", len(mg.CallSites))
+	}
+	group := mg.CallSites[0]
+	if group.Name != "order.GetOrder -> user.GetUser" {
+		t.Errorf("unexpected name %s", group.Name)
+	}
+	if len(group.Sites) != len(sites) {
+		t.Errorf("unexpected call sites: %d", len(group.Sites))
+	}
+	// the edge links to the first call site, and its tooltip lists all of them.
+	if !strings.Contains(mg.Graph, sites[0].URL) {
+		t.Errorf("graph doesn't link to %s", sites[0].URL)
+	}
+	for _, site := range sites {
+		if !strings.Contains(mg.Graph, site.Location()) {
+			t.Errorf("graph doesn't show %s", site.Location())
+		}
+	}
+}
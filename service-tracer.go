@@ -1,10 +1,11 @@
 package servicetracer
 
 import (
-	"io/ioutil"
+	"context"
+	"fmt"
+	"io"
 	"os"
 
-	"github.com/goccy/go-yaml"
 	"golang.org/x/xerrors"
 )
 
@@ -12,68 +13,178 @@ type ServiceTracer struct {
 	cfg      *Config
 	analyzer *Analyzer
 	renderer *Renderer
+	progress *progress
+	failures []*AnalysisFailure
+}
+
+// AnalysisFailure is the service which couldn't be analyzed ( e.g. timed out ).
+// The other services are rendered without it, and it's analyzed again on the next run.
+type AnalysisFailure struct {
+	Service string
+	Reason  string
+}
+
+func (f *AnalysisFailure) Error() string {
+	return fmt.Sprintf("failed to analyze %s: %s", f.Service, f.Reason)
 }
 
 func New(cfg *Config) *ServiceTracer {
-	return &ServiceTracer{
+	t := &ServiceTracer{
 		cfg:      cfg,
 		analyzer: NewAnalyzer(cfg),
 		renderer: NewRenderer(cfg),
 	}
+	t.analyzer.SetMessageOutput(t.messageOutput())
+	if cfg.Progress == "json" {
+		t.SetProgressReporter(NewJSONProgressReporter(os.Stdout))
+	} else {
+		t.SetProgressReporter(NewTextProgressReporter(os.Stdout))
+	}
+	return t
+}
+
+// SetProgressReporter changes the reporter of the stages of tracing.
+func (t *ServiceTracer) SetProgressReporter(reporter ProgressReporter) {
+	t.progress = newProgress(reporter)
+	t.analyzer.progress = t.progress
+}
+
+// RegisterDetector adds detector to find outbound dependencies other than gRPC client stubs.
+func (t *ServiceTracer) RegisterDetector(detector Detector) {
+	t.analyzer.RegisterDetector(detector)
+}
+
+// RegisterEntryDetector adds detector to find entry points other than gRPC handlers.
+func (t *ServiceTracer) RegisterEntryDetector(detector EntryDetector) {
+	t.analyzer.RegisterEntryDetector(detector)
 }
 
 func (t *ServiceTracer) Run() error {
-	if err := CreateCacheDir(); err != nil {
-		return xerrors.Errorf("failed to create cache dir: %w", err)
-	}
-	if err := CloneRepository(t.cfg); err != nil {
-		return xerrors.Errorf("failed to clone repository: %w", err)
+	return t.RunContext(context.Background())
+}
+
+// RunContext analyzes services and renders them. Cancelling ctx stops the run at the next stage.
+// If this process is the child of the isolated analysis, it analyzes only the service given by the parent.
+func (t *ServiceTracer) RunContext(ctx context.Context) error {
+	if name, output, ok := isolatedAnalysis(); ok {
+		return t.runIsolated(ctx, name, output)
 	}
-	methodMap, err := t.createMethodMap()
+	methodMap, err := t.prepareMethodMap(ctx)
 	if err != nil {
-		return xerrors.Errorf("failed to create method map: %w", err)
+		return xerrors.Errorf("failed to prepare method map: %w", err)
 	}
-	if err := t.renderer.Render(methodMap); err != nil {
+	done := t.progress.start("", RenderStage)
+	err = t.renderer.Render(methodMap, t.failures...)
+	done(err)
+	if err != nil {
 		return xerrors.Errorf("failed to render method map: %w", err)
 	}
 	return nil
 }
 
-func (t *ServiceTracer) createMethodMap() (MethodMap, error) {
+func (t *ServiceTracer) prepareMethodMap(ctx context.Context) (MethodMap, error) {
+	if err := CreateCacheDir(); err != nil {
+		return nil, xerrors.Errorf("failed to create cache dir: %w", err)
+	}
+	for _, service := range t.cfg.Services {
+		done := t.progress.start(service.Name, CloneStage)
+		err := CloneService(ctx, t.cfg, service, t.messageOutput())
+		done(err)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to clone repository: %w", err)
+		}
+	}
+	methodMap, err := t.createMethodMap(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create method map: %w", err)
+	}
+	return methodMap, nil
+}
+
+// messageOutput returns the writer of the messages other than the progress events ( e.g. the progress of git ).
+// The JSON progress owns stdout, so the messages are written to stderr instead.
+func (t *ServiceTracer) messageOutput() io.Writer {
+	if t.cfg.Progress == "json" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// analyze analyzes the service within the timeout of the service.
+// Pointer analysis can't be cancelled on the way, so it's abandoned in the background when the analysis times out.
+// The isolated analysis is killed instead.
+func (t *ServiceTracer) analyze(ctx context.Context, service *Service) (MethodMap, error) {
+	timeout, err := service.AnalysisTimeout(t.cfg.Timeout)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get timeout: %w", err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	type result struct {
+		methodMap MethodMap
+		err       error
+	}
+	done := t.progress.start(service.Name, AnalyzeStage)
+	ch := make(chan *result, 1)
+	go func() {
+		var (
+			methodMap MethodMap
+			err       error
+		)
+		if t.cfg.Isolate {
+			methodMap, err = t.analyzeInChild(ctx, service)
+		} else {
+			methodMap, err = t.analyzer.AnalyzeContext(ctx, service)
+		}
+		ch <- &result{methodMap: methodMap, err: err}
+	}()
+	select {
+	case r := <-ch:
+		done(r.err)
+		return r.methodMap, r.err
+	case <-ctx.Done():
+		done(ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+func (t *ServiceTracer) createMethodMap(ctx context.Context) (MethodMap, error) {
 	methodMap := MethodMap{}
 	for _, service := range t.cfg.Services {
 		cachePath := ServiceMapFile(service)
 		if _, err := os.Stat(cachePath); err == nil {
-			file, err := ioutil.ReadFile(cachePath)
+			cm, compatible, err := t.loadMethodMap(service, cachePath)
 			if err != nil {
-				return nil, xerrors.Errorf("failed to read maps cache: %w", err)
+				return nil, xerrors.Errorf("failed to load maps cache: %w", err)
 			}
-			var cm MethodMap
-			if err := yaml.Unmarshal(file, &cm); err != nil {
-				return nil, xerrors.Errorf("failed to unmarshal callmap file: %w", err)
-			}
-			for k, v := range cm {
-				for _, mtd := range v.Methods {
-					service, err := t.cfg.ServiceNameByGeneratedPath(mtd.GeneratedPath)
-					if err != nil {
-						return nil, xerrors.Errorf("failed to get service name: %w", err)
-					}
-					mtd.Service = service
+			if compatible {
+				for k, v := range cm {
+					methodMap[k] = v
 				}
-				methodMap[k] = v
+				continue
 			}
-			continue
 		}
-		cm, err := t.analyzer.Analyze(service)
+		cm, err := t.analyze(ctx, service)
 		if err != nil {
+			var failure *AnalysisFailure
+			if xerrors.As(err, &failure) {
+				t.failures = append(t.failures, failure)
+				continue
+			}
+			if ctx.Err() == nil && xerrors.Is(err, context.DeadlineExceeded) {
+				t.failures = append(t.failures, &AnalysisFailure{
+					Service: service.Name,
+					Reason:  "timed out",
+				})
+				continue
+			}
 			return nil, xerrors.Errorf("failed to analyze: %w", err)
 		}
-		b, err := yaml.Marshal(cm)
-		if err != nil {
-			return nil, xerrors.Errorf("failed to marshal method map: %w", err)
-		}
-		if err := ioutil.WriteFile(cachePath, b, 0644); err != nil {
-			return nil, xerrors.Errorf("failed to write method map file: %w", err)
+		if err := writeMethodMapCache(cachePath, service, cm); err != nil {
+			return nil, xerrors.Errorf("failed to write maps cache: %w", err)
 		}
 		for k, v := range cm {
 			methodMap[k] = v
@@ -81,3 +192,54 @@ func (t *ServiceTracer) createMethodMap() (MethodMap, error) {
 	}
 	return methodMap, nil
 }
+
+// loadMethodMap reads the method map written in the cache format.
+// If the cache is incompatible with this version ( e.g. written in the older format ) or stale
+// ( e.g. written by the other version or the repository has new commits ), it returns false to regenerate it.
+func (t *ServiceTracer) loadMethodMap(service *Service, path string) (MethodMap, bool, error) {
+	cache, err := ReadMethodMapCache(path)
+	if err != nil {
+		return nil, false, xerrors.Errorf("failed to read method map cache: %w", err)
+	}
+	if reason := cache.Incompatibility(); reason != "" {
+		fmt.Fprintf(t.messageOutput(), "%s: regenerating incompatible cache ( %s )\n", service.Name, reason)
+		return nil, false, nil
+	}
+	if reason := cache.Staleness(service); reason != "" {
+		fmt.Fprintf(t.messageOutput(), "%s: regenerating stale cache ( %s )\n", service.Name, reason)
+		return nil, false, nil
+	}
+	if err := resolveServiceNames(t.cfg, cache.Methods); err != nil {
+		return nil, false, xerrors.Errorf("failed to resolve service names: %w", err)
+	}
+	return cache.Methods, true, nil
+}
+
+// resolveServiceNames re-maps the gRPC methods in methodMap to the services of the config by the generated path.
+func resolveServiceNames(cfg *Config, methodMap MethodMap) error {
+	for _, v := range methodMap {
+		for _, mtd := range v.Methods {
+			if err := resolveServiceName(cfg, mtd); err != nil {
+				return xerrors.Errorf("failed to resolve service name: %w", err)
+			}
+		}
+		for _, dep := range v.Dependencies {
+			if err := resolveServiceName(cfg, dep.Method); err != nil {
+				return xerrors.Errorf("failed to resolve service name: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func resolveServiceName(cfg *Config, mtd *Method) error {
+	if !mtd.IsGRPC() {
+		return nil
+	}
+	service, err := cfg.ServiceNameByGeneratedPath(mtd.GeneratedPath)
+	if err != nil {
+		return xerrors.Errorf("failed to get service name: %w", err)
+	}
+	mtd.Service = service
+	return nil
+}
@@ -0,0 +1,48 @@
+package servicetracer
+
+import (
+	"sort"
+
+	"golang.org/x/tools/go/callgraph"
+)
+
+// sortNodes sorts the call graph nodes by the function name.
+func sortNodes(nodes []*callgraph.Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		x, y := nodes[i].Func.String(), nodes[j].Func.String()
+		if x != y {
+			return x < y
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+}
+
+// sortEdges sorts the edges from the same caller by the position of the call site and the callee.
+func sortEdges(edges []*callgraph.Edge) {
+	sort.SliceStable(edges, func(i, j int) bool {
+		x, y := edges[i].Pos(), edges[j].Pos()
+		if x != y {
+			return x < y
+		}
+		return edges[i].Callee.Func.String() < edges[j].Callee.Func.String()
+	})
+}
+
+func sortCallSites(sites []*CallSite) {
+	sort.SliceStable(sites, func(i, j int) bool {
+		x, y := sites[i], sites[j]
+		if x.File != y.File {
+			return x.File < y.File
+		}
+		if x.Line != y.Line {
+			return x.Line < y.Line
+		}
+		return x.Caller < y.Caller
+	})
+}
+
+func sortMethods(mtds []*Method) {
+	sort.SliceStable(mtds, func(i, j int) bool {
+		return mtds[i].MangledName() < mtds[j].MangledName()
+	})
+}
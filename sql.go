@@ -0,0 +1,156 @@
+package servicetracer
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	readAccess      = "read"
+	writeAccess     = "write"
+	readWriteAccess = "read/write"
+)
+
+var (
+	sqlIdentPart  = "(?:\"[^\"]*\"|`[^`]*`|\\[[^\\]]*\\]|[A-Za-z_*][A-Za-z0-9_$*]*)"
+	sqlTokPattern = regexp.MustCompile(`'(?:[^']|'')*'|` + sqlIdentPart + `(?:\.` + sqlIdentPart + `)*|[(),;]|\S`)
+)
+
+type tableAccess struct {
+	table  string
+	access string
+}
+
+// parseSQL extracts the tables accessed by query with the read or write intent.
+// It isn't a complete SQL parser, but recognizes tables after FROM, JOIN, INTO, UPDATE and TRUNCATE,
+// ignoring subqueries and common table expressions.
+// FROM inside of the parentheses other than subqueries is the argument of the function like EXTRACT(YEAR FROM created_at).
+func parseSQL(query string) []*tableAccess {
+	tokens := sqlTokPattern.FindAllString(query, -1)
+	cteMap := map[string]struct{}{}
+	for idx, tok := range tokens {
+		// WITH name AS ( ... ), name AS ( ... )
+		if idx+2 >= len(tokens) || !strings.EqualFold(tokens[idx+1], "as") || tokens[idx+2] != "(" {
+			continue
+		}
+		if idx > 0 && (strings.EqualFold(tokens[idx-1], "with") || strings.EqualFold(tokens[idx-1], "recursive") || tokens[idx-1] == ",") {
+			cteMap[strings.ToLower(unquoteSQLIdent(tok))] = struct{}{}
+		}
+	}
+
+	accessMap := map[string]string{}
+	tables := []string{}
+	addTable := func(tok, access string) {
+		table := unquoteSQLIdent(tok)
+		if _, exists := cteMap[strings.ToLower(table)]; exists {
+			return
+		}
+		if current, exists := accessMap[table]; exists {
+			accessMap[table] = mergeAccess(current, access)
+			return
+		}
+		accessMap[table] = access
+		tables = append(tables, table)
+	}
+	// subqueries has true for each open parenthesis whether it starts the subquery.
+	subqueries := []bool{}
+	for idx := 0; idx < len(tokens); idx++ {
+		keyword := strings.ToLower(tokens[idx])
+		var prev string
+		if idx > 0 {
+			prev = strings.ToLower(tokens[idx-1])
+		}
+		switch keyword {
+		case "(":
+			subquery := idx+1 < len(tokens) && (strings.EqualFold(tokens[idx+1], "select") || strings.EqualFold(tokens[idx+1], "with"))
+			subqueries = append(subqueries, subquery)
+		case ")":
+			if len(subqueries) > 0 {
+				subqueries = subqueries[:len(subqueries)-1]
+			}
+		case "from":
+			if len(subqueries) > 0 && !subqueries[len(subqueries)-1] {
+				continue
+			}
+			access := readAccess
+			if prev == "delete" {
+				access = writeAccess
+			}
+			// FROM a, b
+			for next := idx + 1; next < len(tokens) && isSQLTable(tokens[next]); {
+				addTable(tokens[next], access)
+				next++
+				if next < len(tokens) && !isSQLKeyword(tokens[next]) && isSQLTable(tokens[next]) {
+					// alias
+					next++
+				}
+				if next >= len(tokens) || tokens[next] != "," {
+					break
+				}
+				next++
+			}
+		case "join":
+			if idx+1 < len(tokens) && isSQLTable(tokens[idx+1]) {
+				addTable(tokens[idx+1], readAccess)
+			}
+		case "into", "update", "truncate":
+			// ON DUPLICATE KEY UPDATE and SELECT ... FOR UPDATE aren't table access.
+			if keyword == "update" && (prev == "key" || prev == "for") {
+				continue
+			}
+			next := idx + 1
+			if next < len(tokens) && strings.EqualFold(tokens[next], "table") {
+				next++
+			}
+			if next < len(tokens) && isSQLTable(tokens[next]) {
+				addTable(tokens[next], writeAccess)
+			}
+		}
+	}
+	accesses := make([]*tableAccess, 0, len(tables))
+	for _, table := range tables {
+		accesses = append(accesses, &tableAccess{table: table, access: accessMap[table]})
+	}
+	return accesses
+}
+
+func isSQLTable(tok string) bool {
+	if tok == "" || tok == "(" || tok == ")" || tok == "," || tok == ";" || strings.HasPrefix(tok, "'") {
+		return false
+	}
+	if isSQLKeyword(tok) {
+		return false
+	}
+	c := tok[0]
+	return c == '"' || c == '`' || c == '[' || c == '_' || c == '*' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+var sqlKeywords = map[string]struct{}{
+	"select": {}, "where": {}, "join": {}, "inner": {}, "left": {}, "right": {}, "full": {}, "outer": {},
+	"cross": {}, "on": {}, "using": {}, "group": {}, "order": {}, "by": {}, "having": {}, "limit": {},
+	"offset": {}, "union": {}, "values": {}, "set": {}, "lateral": {}, "only": {}, "as": {}, "natural": {},
+	"returning": {}, "for": {}, "window": {}, "ignore": {}, "default": {},
+}
+
+func isSQLKeyword(tok string) bool {
+	_, exists := sqlKeywords[strings.ToLower(tok)]
+	return exists
+}
+
+func unquoteSQLIdent(ident string) string {
+	parts := strings.Split(ident, ".")
+	for idx, part := range parts {
+		parts[idx] = strings.Trim(part, "\"`[]")
+	}
+	return strings.Join(parts, ".")
+}
+
+func mergeAccess(a, b string) string {
+	if a == b || b == "" {
+		return a
+	}
+	if a == "" {
+		return b
+	}
+	return readWriteAccess
+}
@@ -0,0 +1,121 @@
+package servicetracer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []*tableAccess
+	}{
+		{
+			name:  "select",
+			query: "SELECT id, name FROM users WHERE id = ?",
+			want:  []*tableAccess{{table: "users", access: readAccess}},
+		},
+		{
+			name:  "select from multiple tables with alias",
+			query: "SELECT * FROM users u, orders o WHERE u.id = o.user_id",
+			want:  []*tableAccess{{table: "users", access: readAccess}, {table: "orders", access: readAccess}},
+		},
+		{
+			name:  "join",
+			query: "SELECT * FROM users INNER JOIN orders ON users.id = orders.user_id",
+			want:  []*tableAccess{{table: "users", access: readAccess}, {table: "orders", access: readAccess}},
+		},
+		{
+			name:  "quoted and qualified",
+			query: "SELECT * FROM `app`.`users`",
+			want:  []*tableAccess{{table: "app.users", access: readAccess}},
+		},
+		{
+			name:  "insert",
+			query: "INSERT INTO users (id, name) VALUES (?, ?)",
+			want:  []*tableAccess{{table: "users", access: writeAccess}},
+		},
+		{
+			name:  "insert select",
+			query: "INSERT INTO archived_users (id) SELECT id FROM users",
+			want:  []*tableAccess{{table: "archived_users", access: writeAccess}, {table: "users", access: readAccess}},
+		},
+		{
+			name:  "update",
+			query: "UPDATE users SET name = ? WHERE id = ?",
+			want:  []*tableAccess{{table: "users", access: writeAccess}},
+		},
+		{
+			name:  "delete",
+			query: "DELETE FROM users WHERE id = ?",
+			want:  []*tableAccess{{table: "users", access: writeAccess}},
+		},
+		{
+			name:  "truncate",
+			query: "TRUNCATE TABLE users",
+			want:  []*tableAccess{{table: "users", access: writeAccess}},
+		},
+		{
+			name:  "read and write",
+			query: "UPDATE users SET count = (SELECT COUNT(*) FROM users)",
+			want:  []*tableAccess{{table: "users", access: readWriteAccess}},
+		},
+		{
+			name:  "subquery",
+			query: "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)",
+			want:  []*tableAccess{{table: "users", access: readAccess}, {table: "orders", access: readAccess}},
+		},
+		{
+			name:  "common table expression",
+			query: "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent",
+			want:  []*tableAccess{{table: "orders", access: readAccess}},
+		},
+		{
+			name:  "on duplicate key update",
+			query: "INSERT INTO users (id) VALUES (?) ON DUPLICATE KEY UPDATE id = id",
+			want:  []*tableAccess{{table: "users", access: writeAccess}},
+		},
+		{
+			name:  "select for update",
+			query: "SELECT * FROM users FOR UPDATE",
+			want:  []*tableAccess{{table: "users", access: readAccess}},
+		},
+		{
+			name:  "from in function",
+			query: "SELECT EXTRACT(YEAR FROM created_at) FROM users",
+			want:  []*tableAccess{{table: "users", access: readAccess}},
+		},
+		{
+			name:  "from in nested function",
+			query: "SELECT COALESCE(SUBSTRING(name FROM 2), '') FROM users",
+			want:  []*tableAccess{{table: "users", access: readAccess}},
+		},
+		{
+			name:  "string literal",
+			query: "SELECT * FROM users WHERE name = 'from x'",
+			want:  []*tableAccess{{table: "users", access: readAccess}},
+		},
+		{
+			name:  "no table",
+			query: "SELECT 1",
+			want:  []*tableAccess{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseSQL(test.query)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseSQL(%q) = %s, want %s", test.query, formatTableAccesses(got), formatTableAccesses(test.want))
+			}
+		})
+	}
+}
+
+func formatTableAccesses(accesses []*tableAccess) []string {
+	formatted := make([]string, 0, len(accesses))
+	for _, access := range accesses {
+		formatted = append(formatted, access.table+":"+access.access)
+	}
+	return formatted
+}
@@ -0,0 +1,116 @@
+package servicetracer
+
+import (
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	sqlPkgPath      = "database/sql"
+	sqlxPkgPath     = "github.com/jmoiron/sqlx"
+	gormPkgPath     = "gorm.io/gorm"
+	jinzhuGormPath  = "github.com/jinzhu/gorm"
+	databaseService = "database"
+)
+
+var (
+	// sqlQueryArgIndex maps the function named relative to its package ( e.g. "(*DB).QueryContext" )
+	// to the index of the query argument ( excluding the receiver ).
+	// Prepared statements have no query argument, so the tables are detected at Prepare instead.
+	sqlQueryArgIndex = map[string]map[string]int{
+		sqlPkgPath: {
+			"(*DB).Query": 0, "(*DB).QueryContext": 1, "(*DB).QueryRow": 0, "(*DB).QueryRowContext": 1,
+			"(*DB).Exec": 0, "(*DB).ExecContext": 1, "(*DB).Prepare": 0, "(*DB).PrepareContext": 1,
+			"(*Tx).Query": 0, "(*Tx).QueryContext": 1, "(*Tx).QueryRow": 0, "(*Tx).QueryRowContext": 1,
+			"(*Tx).Exec": 0, "(*Tx).ExecContext": 1, "(*Tx).Prepare": 0, "(*Tx).PrepareContext": 1,
+			"(*Conn).QueryContext": 1, "(*Conn).QueryRowContext": 1, "(*Conn).ExecContext": 1, "(*Conn).PrepareContext": 1,
+		},
+		sqlxPkgPath: {
+			"(*DB).Get": 1, "(*DB).GetContext": 2, "(*DB).Select": 1, "(*DB).SelectContext": 2,
+			"(*DB).Queryx": 0, "(*DB).QueryxContext": 1, "(*DB).QueryRowx": 0, "(*DB).QueryRowxContext": 1,
+			"(*DB).NamedExec": 0, "(*DB).NamedExecContext": 1, "(*DB).NamedQuery": 0, "(*DB).NamedQueryContext": 1,
+			"(*DB).MustExec": 0, "(*DB).MustExecContext": 1, "(*DB).Preparex": 0, "(*DB).PreparexContext": 1,
+			"(*DB).PrepareNamed": 0, "(*DB).PrepareNamedContext": 1,
+			"(*Tx).Get": 1, "(*Tx).GetContext": 2, "(*Tx).Select": 1, "(*Tx).SelectContext": 2,
+			"(*Tx).Queryx": 0, "(*Tx).QueryxContext": 1, "(*Tx).QueryRowx": 0, "(*Tx).QueryRowxContext": 1,
+			"(*Tx).NamedExec": 0, "(*Tx).NamedExecContext": 1, "(*Tx).NamedQuery": 0,
+			"(*Tx).MustExec": 0, "(*Tx).MustExecContext": 1, "(*Tx).Preparex": 0, "(*Tx).PreparexContext": 1,
+			"(*Tx).PrepareNamed": 0, "(*Tx).PrepareNamedContext": 1,
+			"(*Conn).GetContext": 2, "(*Conn).SelectContext": 2, "(*Conn).QueryxContext": 1,
+			"(*Conn).QueryRowxContext": 1, "(*Conn).PreparexContext": 1,
+			// package-level functions take the querier first.
+			"Get": 2, "GetContext": 3, "Select": 2, "SelectContext": 3,
+			"NamedExec": 1, "NamedExecContext": 2, "NamedQuery": 1, "NamedQueryContext": 2,
+			"MustExec": 1, "MustExecContext": 2, "Preparex": 1, "PreparexContext": 2,
+			"PrepareNamed": 1, "PrepareNamedContext": 2,
+		},
+		gormPkgPath: {
+			"(*DB).Raw": 0, "(*DB).Exec": 0,
+		},
+		jinzhuGormPath: {
+			"(*DB).Raw": 0, "(*DB).Exec": 0,
+		},
+	}
+)
+
+// TableDetector detects database table accesses by database/sql, sqlx and gorm.
+// Tables and the read or write intent are extracted from constant SQL strings.
+// gorm's (*DB).Table is also detected, but the intent is unknown.
+type TableDetector struct{}
+
+func (d *TableDetector) Name() string {
+	return "table"
+}
+
+func (d *TableDetector) Detect(ctx *DetectContext, edge *callgraph.Edge) ([]*Method, error) {
+	if edge.Site == nil {
+		return nil, nil
+	}
+	pkgPath := nodeToPkgPath(edge.Callee)
+	argIndexMap, exists := sqlQueryArgIndex[pkgPath]
+	if !exists {
+		return nil, nil
+	}
+	// ignore queries issued inside of database libraries ( e.g. sqlx calls database/sql ).
+	if _, exists := sqlQueryArgIndex[nodeToPkgPath(edge.Caller)]; exists {
+		return nil, nil
+	}
+	fn := edge.Callee.Func
+	args := callArgs(edge.Site, fn)
+	if (pkgPath == gormPkgPath || pkgPath == jinzhuGormPath) && fn.Name() == "Table" && fn.Signature.Recv() != nil {
+		table, _ := resolveString(args[0])
+		return []*Method{tableMethod(table, "")}, nil
+	}
+	idx, exists := argIndexMap[relFuncName(fn)]
+	if !exists || idx >= len(args) {
+		return nil, nil
+	}
+	return d.tables(args[idx]), nil
+}
+
+func (d *TableDetector) tables(v ssa.Value) []*Method {
+	query, _ := resolveString(v)
+	if strings.Trim(query, unresolvedPart+" ") == "" {
+		return []*Method{tableMethod(unresolvedPart, "")}
+	}
+	accesses := parseSQL(query)
+	if len(accesses) == 0 {
+		return []*Method{tableMethod(unresolvedPart, "")}
+	}
+	tables := make([]*Method, 0, len(accesses))
+	for _, access := range accesses {
+		tables = append(tables, tableMethod(access.table, access.access))
+	}
+	return tables
+}
+
+func tableMethod(table, access string) *Method {
+	return &Method{
+		Kind:    TableMethodKind,
+		Service: databaseService,
+		Name:    table,
+		Access:  access,
+	}
+}